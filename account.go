@@ -0,0 +1,460 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// An Account is a be2bill account registered in a Registry,
+// with the clients used to perform its operations.
+type Account struct {
+	// Name is the name of the account in the registry.
+	Name string
+	// Credentials are the credentials of the account.
+	Credentials *Credentials
+	// DirectLink is the client used for the Direct Link operations.
+	DirectLink *DirectLinkClient
+	// Form is the client used to build payment forms.
+	Form *FormClient
+}
+
+// SetSigner sets the Signer of both clients of the account, which is
+// also used to verify the notifications and returns of the account.
+func (p *Account) SetSigner(s *Signer) {
+	p.DirectLink.Signer = s
+	p.Form.Signer = s
+}
+
+// An UnknownAccountError is returned by Registry operations when no
+// registered account matches a request.
+type UnknownAccountError struct {
+	// Name is the name of the selected account, if any.
+	Name string
+	// Identifier is the IDENTIFIER of a request received from
+	// the be2bill servers or from a customer.
+	Identifier string
+}
+
+func (e *UnknownAccountError) Error() string {
+	switch {
+	case e.Identifier != "":
+		return fmt.Sprintf("unknown account identifier %q", e.Identifier)
+	case e.Name != "":
+		return fmt.Sprintf("unknown account %q", e.Name)
+	}
+	return "no account selected"
+}
+
+type contextKey int
+
+const (
+	accountKey contextKey = iota
+	currencyKey
+)
+
+// WithAccount returns a copy of ctx that selects the named account for
+// the Registry operations using it, regardless of the routing rules.
+func WithAccount(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, accountKey, name)
+}
+
+// WithCurrency returns a copy of ctx carrying the ISO 4217 code of
+// the currency of an operation, for rules such as RouteByCurrency.
+//
+// The be2bill API has no currency parameter, each account processing
+// a single currency, so the currency is never sent to the servers.
+func WithCurrency(ctx context.Context, currency string) context.Context {
+	return context.WithValue(ctx, currencyKey, currency)
+}
+
+// A Rule chooses the account of a Registry operation from its context,
+// its operation type and its parameters.
+// It returns the name of the account, or an empty string if it does not
+// apply to the operation.
+type Rule func(ctx context.Context, operationType string, params Options) string
+
+// RouteByCurrency returns a Rule selecting the named account for the
+// operations whose context carries the given currency.
+func RouteByCurrency(currency, account string) Rule {
+	return func(ctx context.Context, operationType string, params Options) string {
+		if c, ok := ctx.Value(currencyKey).(string); ok && c == currency {
+			return account
+		}
+		return ""
+	}
+}
+
+// RouteByParam returns a Rule selecting the named account for the
+// operations whose parameter of the given name has the given value,
+// such as Param3DSecure with the value "yes".
+func RouteByParam(name, value, account string) Rule {
+	return func(ctx context.Context, operationType string, params Options) string {
+		if v, ok := params[name]; ok && fmt.Sprint(v) == value {
+			return account
+		}
+		return ""
+	}
+}
+
+// A Registry holds several be2bill accounts, for example one per brand,
+// per currency, or for 3-D Secure and non 3-D Secure transactions.
+//
+// The operations of a Registry are performed by the account named in
+// their context with WithAccount, or else by the account chosen by the
+// first matching rule, or else by the default account.
+// Requests received from the be2bill servers or from customers are
+// verified using the account of their IDENTIFIER parameter.
+//
+// A Registry is safe for concurrent use.
+type Registry struct {
+	mu             sync.RWMutex
+	accounts       map[string]*Account
+	identifiers    map[string]*Account
+	rules          []Rule
+	defaultAccount string
+}
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		accounts:    make(map[string]*Account),
+		identifiers: make(map[string]*Account),
+	}
+}
+
+// Register adds an account with the given name and credentials, and returns
+// it so that its clients can be configured.
+// The first registered account is the default account.
+func (p *Registry) Register(name string, credentials *Credentials) *Account {
+	a := &Account{
+		Name:        name,
+		Credentials: credentials,
+		DirectLink:  NewDirectLinkClient(credentials),
+		Form:        NewFormClient(credentials),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the identifier of a replaced account may have been reused since
+	if old, ok := p.accounts[name]; ok && p.identifiers[old.Credentials.identifier] == old {
+		delete(p.identifiers, old.Credentials.identifier)
+	}
+	p.accounts[name] = a
+	p.identifiers[credentials.identifier] = a
+	if p.defaultAccount == "" {
+		p.defaultAccount = name
+	}
+	return a
+}
+
+// AddRule appends a rule used to choose the account of the operations.
+// Rules are evaluated in the order they are added.
+func (p *Registry) AddRule(rule Rule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = append(p.rules, rule)
+}
+
+// SetDefault sets the name of the account used when no rule applies.
+func (p *Registry) SetDefault(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaultAccount = name
+}
+
+// Account returns the account with the given name, or nil if there is none.
+func (p *Registry) Account(name string) *Account {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.accounts[name]
+}
+
+// AccountByIdentifier returns the account with the given be2bill identifier,
+// or nil if there is none.
+func (p *Registry) AccountByIdentifier(identifier string) *Account {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.identifiers[identifier]
+}
+
+// Select returns the account performing an operation of the given type
+// with the given context and parameters.
+// It returns an *UnknownAccountError if the selected account is not
+// registered.
+func (p *Registry) Select(ctx context.Context, operationType string, params Options) (*Account, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	name, _ := ctx.Value(accountKey).(string)
+	if name == "" {
+		for _, rule := range p.rules {
+			if name = rule(ctx, operationType, params); name != "" {
+				break
+			}
+		}
+	}
+	if name == "" {
+		name = p.defaultAccount
+	}
+
+	a, ok := p.accounts[name]
+	if !ok {
+		return nil, &UnknownAccountError{Name: name}
+	}
+	return a, nil
+}
+
+// signerFor returns the Signer verifying the given parameters received from
+// the be2bill servers or from a customer, from their IDENTIFIER.
+func (p *Registry) signerFor(params Options) (*Signer, error) {
+	identifier, _ := params[ParamIdentifier].(string)
+	a := p.AccountByIdentifier(identifier)
+	if a == nil {
+		return nil, &UnknownAccountError{Identifier: identifier}
+	}
+	return a.DirectLink.signer(), nil
+}
+
+// NewNotificationHandler returns a new NotificationHandler verifying
+// the notifications of every account of the registry.
+func (p *Registry) NewNotificationHandler(handler NotificationFunc) *NotificationHandler {
+	return &NotificationHandler{
+		registry: p,
+		handler:  handler,
+	}
+}
+
+// NewReturnHandler returns a new ReturnHandler verifying the requests
+// of the customers of every account of the registry.
+func (p *Registry) NewReturnHandler(success, failure ReturnFunc) *ReturnHandler {
+	return &ReturnHandler{
+		registry: p,
+		Success:  success,
+		Failure:  failure,
+	}
+}
+
+// ParseReturn verifies and returns the result of a transaction made using
+// a form of any account of the registry, as described in FormClient.ParseReturn.
+func (p *Registry) ParseReturn(r *http.Request) (Result, error) {
+	params, err := parseSignedRequest(r, p.signerFor)
+	if err != nil {
+		return nil, err
+	}
+	return Result(params), nil
+}
+
+// client returns the Direct Link client of the account selected for
+// the given operation.
+func (p *Registry) client(ctx context.Context, operationType string, params Options) (*DirectLinkClient, error) {
+	a, err := p.Select(ctx, operationType, params)
+	if err != nil {
+		return nil, err
+	}
+	return a.DirectLink, nil
+}
+
+// ProcessPayment performs a payment with the selected account,
+// as described in DirectLinkClient.ProcessPayment.
+func (p *Registry) ProcessPayment(ctx context.Context, req *PaymentRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypePayment, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessPayment(ctx, req)
+}
+
+// ProcessAuthorization performs an authorization with the selected account,
+// as described in DirectLinkClient.ProcessAuthorization.
+func (p *Registry) ProcessAuthorization(ctx context.Context, req *AuthorizationRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypeAuthorization, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessAuthorization(ctx, req)
+}
+
+// ProcessCredit performs a credit with the selected account,
+// as described in DirectLinkClient.ProcessCredit.
+func (p *Registry) ProcessCredit(ctx context.Context, req *CreditRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypeCredit, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessCredit(ctx, req)
+}
+
+// ProcessOneClickPayment performs a payment with the selected account,
+// as described in DirectLinkClient.ProcessOneClickPayment.
+func (p *Registry) ProcessOneClickPayment(ctx context.Context, req *AliasPaymentRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypePayment, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessOneClickPayment(ctx, req)
+}
+
+// ProcessSubscriptionPayment performs a payment with the selected account,
+// as described in DirectLinkClient.ProcessSubscriptionPayment.
+func (p *Registry) ProcessSubscriptionPayment(ctx context.Context, req *AliasPaymentRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypePayment, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessSubscriptionPayment(ctx, req)
+}
+
+// ProcessOneClickAuthorization performs an authorization with the selected
+// account, as described in DirectLinkClient.ProcessOneClickAuthorization.
+func (p *Registry) ProcessOneClickAuthorization(ctx context.Context, req *AliasAuthorizationRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypeAuthorization, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessOneClickAuthorization(ctx, req)
+}
+
+// ProcessSubscriptionAuthorization performs an authorization with the
+// selected account, as described in
+// DirectLinkClient.ProcessSubscriptionAuthorization.
+func (p *Registry) ProcessSubscriptionAuthorization(ctx context.Context, req *AliasAuthorizationRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypeAuthorization, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessSubscriptionAuthorization(ctx, req)
+}
+
+// ProcessRedirectForPayment performs a payment with the selected account,
+// as described in DirectLinkClient.ProcessRedirectForPayment.
+func (p *Registry) ProcessRedirectForPayment(ctx context.Context, req *RedirectForPaymentRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypePayment, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessRedirectForPayment(ctx, req)
+}
+
+// ProcessCapture performs a capture with the selected account,
+// as described in DirectLinkClient.ProcessCapture.
+// The capture must be performed by the account of the authorization,
+// which is usually selected with WithAccount.
+func (p *Registry) ProcessCapture(ctx context.Context, req *CaptureRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypeCapture, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessCapture(ctx, req)
+}
+
+// ProcessRefund performs a refund with the selected account,
+// as described in DirectLinkClient.ProcessRefund.
+// The refund must be performed by the account of the refunded transaction,
+// which is usually selected with WithAccount.
+func (p *Registry) ProcessRefund(ctx context.Context, req *RefundRequest) (Result, error) {
+	c, err := p.client(ctx, OperationTypeRefund, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessRefund(ctx, req)
+}
+
+// StopNTimes cancels the scheduled payments of a transaction with
+// the selected account, as described in DirectLinkClient.StopNTimes.
+// It must be performed by the account of the transaction, which is usually
+// selected with WithAccount.
+func (p *Registry) StopNTimes(ctx context.Context, scheduleID string, options Options) (Result, error) {
+	c, err := p.client(ctx, OperationTypeStopNTimes, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.StopNTimesContext(ctx, scheduleID, options)
+}
+
+// GetTransactionsByTransactionID retrieves transactions with the selected
+// account, as described in DirectLinkClient.GetTransactionsByTransactionID.
+func (p *Registry) GetTransactionsByTransactionID(ctx context.Context, transactionIDs []string, destination, compression string) (Result, error) {
+	c, err := p.client(ctx, OperationTypeGetTransactions, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetTransactionsByTransactionIDContext(ctx, transactionIDs, destination, compression)
+}
+
+// GetTransactionsByOrderID retrieves transactions with the selected account,
+// as described in DirectLinkClient.GetTransactionsByOrderID.
+func (p *Registry) GetTransactionsByOrderID(ctx context.Context, orderIDs []string, destination, compression string) (Result, error) {
+	c, err := p.client(ctx, OperationTypeGetTransactions, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetTransactionsByOrderIDContext(ctx, orderIDs, destination, compression)
+}
+
+// ExportTransactions exports the transactions of the selected account,
+// as described in DirectLinkClient.ExportTransactions.
+func (p *Registry) ExportTransactions(ctx context.Context, startDate, endDate, destination, compression string, options Options) (Result, error) {
+	c, err := p.client(ctx, OperationTypeExportTransactions, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExportTransactionsContext(ctx, startDate, endDate, destination, compression, options)
+}
+
+// ExportChargebacks exports the chargebacks of the selected account,
+// as described in DirectLinkClient.ExportChargebacks.
+func (p *Registry) ExportChargebacks(ctx context.Context, startDate, endDate, destination, compression string, options Options) (Result, error) {
+	c, err := p.client(ctx, OperationTypeExportChargebacks, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExportChargebacksContext(ctx, startDate, endDate, destination, compression, options)
+}
+
+// ExportReconciliation exports the reconciliation of the selected account,
+// as described in DirectLinkClient.ExportReconciliation.
+func (p *Registry) ExportReconciliation(ctx context.Context, date, destination, compression string, options Options) (Result, error) {
+	c, err := p.client(ctx, OperationTypeExportReconciliation, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExportReconciliationContext(ctx, date, destination, compression, options)
+}
+
+// ExportReconciledTransactions exports the reconciled transactions of
+// the selected account, as described in
+// DirectLinkClient.ExportReconciledTransactions.
+func (p *Registry) ExportReconciledTransactions(ctx context.Context, date, destination, compression string, options Options) (Result, error) {
+	c, err := p.client(ctx, OperationTypeExportReconciledTransactions, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExportReconciledTransactionsContext(ctx, date, destination, compression, options)
+}
+
+// BuildPaymentFormButton returns a payment form of the selected account,
+// as described in FormClient.BuildPaymentFormButton.
+func (p *Registry) BuildPaymentFormButton(ctx context.Context, amount Amount, orderID, clientID, description string, htmlOptions, options Options) (string, error) {
+	a, err := p.Select(ctx, OperationTypePayment, options)
+	if err != nil {
+		return "", err
+	}
+	return a.Form.BuildPaymentFormButton(amount, orderID, clientID, description, htmlOptions, options), nil
+}
+
+// BuildAuthorizationFormButton returns an authorization form of the selected
+// account, as described in FormClient.BuildAuthorizationFormButton.
+func (p *Registry) BuildAuthorizationFormButton(ctx context.Context, amount int, orderID, clientID, description string, htmlOptions, options Options) (string, error) {
+	a, err := p.Select(ctx, OperationTypeAuthorization, options)
+	if err != nil {
+		return "", err
+	}
+	return a.Form.BuildAuthorizationFormButton(amount, orderID, clientID, description, htmlOptions, options), nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newAccountServer returns a server answering every request with
+// the identifier it has been sent.
+func newAccountServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"OPERATIONTYPE":%q,"TRANSACTIONID":"A1","EXECCODE":"0000","IDENTIFIER":%q}`,
+			r.FormValue("params[OPERATIONTYPE]"), r.FormValue("params[IDENTIFIER]"))
+	}))
+}
+
+func TestRegistrySelect(t *testing.T) {
+	ts := newAccountServer()
+	defer ts.Close()
+
+	r := NewRegistry()
+	r.Register("eur", User("EUR ACCOUNT", "bar", Environment{ts.URL}))
+	r.Register("usd", User("USD ACCOUNT", "baz", Environment{ts.URL}))
+	r.Register("3ds", User("3DS ACCOUNT", "qux", Environment{ts.URL}))
+	r.AddRule(RouteByParam(Param3DSecure, "yes", "3ds"))
+	r.AddRule(RouteByCurrency("USD", "usd"))
+
+	testCases := []struct {
+		ctx        context.Context
+		options    Options
+		identifier string
+	}{
+		{context.Background(), nil, "EUR ACCOUNT"},
+		{WithCurrency(context.Background(), "USD"), nil, "USD ACCOUNT"},
+		{WithCurrency(context.Background(), "EUR"), nil, "EUR ACCOUNT"},
+		{WithCurrency(context.Background(), "USD"), Options{Param3DSecure: "yes"}, "3DS ACCOUNT"},
+		{WithAccount(WithCurrency(context.Background(), "USD"), "eur"), Options{Param3DSecure: "yes"}, "EUR ACCOUNT"},
+	}
+
+	for _, tc := range testCases {
+		result, err := r.ProcessCapture(tc.ctx, &CaptureRequest{
+			TransactionID: "A1",
+			OrderID:       "order_1",
+			Description:   "capture",
+			Options:       tc.options,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := result.StringValue(ParamIdentifier); id != tc.identifier {
+			t.Errorf("expected %s, got %s", tc.identifier, id)
+		}
+	}
+
+	_, err := r.ProcessRefund(WithAccount(context.Background(), "gbp"), &RefundRequest{
+		TransactionID: "A1",
+		OrderID:       "order_1",
+		Description:   "refund",
+	})
+	if e, ok := err.(*UnknownAccountError); !ok || e.Name != "gbp" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	form, err := r.BuildPaymentFormButton(WithCurrency(context.Background(), "USD"), SingleAmount(100), "order_1", "ident", "desc", nil, nil)
+	if err != nil || !strings.Contains(form, `value="USD ACCOUNT"`) {
+		t.Errorf("unexpected form: %s, %v", form, err)
+	}
+
+	r.SetDefault("usd")
+	if a, _ := r.Select(context.Background(), OperationTypePayment, nil); a != r.Account("usd") {
+		t.Errorf("unexpected default account: %v", a)
+	}
+}
+
+func TestRegistryVerification(t *testing.T) {
+	r := NewRegistry()
+	r.Register("eur", SandboxUser("foo", "bar"))
+	r.Register("usd", SandboxUser("USD ACCOUNT", "baz"))
+
+	var received Result
+	h := r.NewNotificationHandler(func(req *http.Request, result Result) error {
+		received = result
+		return nil
+	})
+
+	w := postNotification(h, signedParams("bar", ExecCodeSuccess).urlValues().Encode())
+	if w.Code != http.StatusOK || received == nil {
+		t.Errorf("unexpected status: %d", w.Code)
+	}
+
+	// signed with the password of another account
+	w = postNotification(h, signedParams("baz", ExecCodeSuccess).urlValues().Encode())
+	if w.Code != http.StatusForbidden {
+		t.Errorf("unexpected status: %d", w.Code)
+	}
+
+	unknown := Options{ParamIdentifier: "unknown", ParamOrderID: "order_1"}
+	unknown[ParamHash] = DefaultHasher().ComputeHash("bar", unknown)
+	var handlerErr error
+	h.ErrorHandler = func(req *http.Request, err error) {
+		handlerErr = err
+	}
+	w = postNotification(h, unknown.urlValues().Encode())
+	if e, ok := handlerErr.(*UnknownAccountError); w.Code != http.StatusForbidden || !ok || e.Identifier != "unknown" {
+		t.Errorf("unexpected status %d, error: %v", w.Code, handlerErr)
+	}
+
+	req := httptest.NewRequest("GET", "/return?"+signedParams("bar", ExecCodeSuccess).urlValues().Encode(), nil)
+	if _, err := r.ParseReturn(req); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	req = httptest.NewRequest("GET", "/return?ORDERID=order_1&EXECCODE=0000", nil)
+	if _, err := r.ParseReturn(req); err != ErrMissingHash {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// password rotation of one account
+	r.Account("eur").SetSigner(NewSigner(nil, Secret{ID: "new", Password: "new"}, Secret{ID: "old", Password: "bar"}))
+	rh := r.NewReturnHandler(func(w http.ResponseWriter, req *http.Request, result Result) {
+		fmt.Fprint(w, "success")
+	}, nil)
+	for _, password := range []string{"new", "bar"} {
+		w := httptest.NewRecorder()
+		rh.ServeHTTP(w, httptest.NewRequest("GET", "/return?"+signedParams(password, ExecCodeSuccess).urlValues().Encode(), nil))
+		if w.Body.String() != "success" {
+			t.Errorf("%s: unexpected response %d: %s", password, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRegistryBackOffice(t *testing.T) {
+	ts := newAccountServer()
+	defer ts.Close()
+
+	r := NewRegistry()
+	r.Register("eur", User("EUR ACCOUNT", "bar", Environment{ts.URL}))
+	r.Register("usd", User("USD ACCOUNT", "baz", Environment{ts.URL}))
+	r.AddRule(RouteByCurrency("USD", "usd"))
+	ctx := WithCurrency(context.Background(), "USD")
+
+	operations := map[string]func() (Result, error){
+		OperationTypeStopNTimes: func() (Result, error) {
+			return r.StopNTimes(ctx, "A1", nil)
+		},
+		OperationTypeGetTransactions: func() (Result, error) {
+			return r.GetTransactionsByOrderID(ctx, []string{"order_1"}, "foo@example.org", CompressionGzip)
+		},
+		OperationTypeExportTransactions: func() (Result, error) {
+			return r.ExportTransactions(ctx, "2016-01", "", "foo@example.org", CompressionGzip, nil)
+		},
+		OperationTypeExportChargebacks: func() (Result, error) {
+			return r.ExportChargebacks(ctx, "2016-01", "", "foo@example.org", CompressionGzip, nil)
+		},
+		OperationTypeExportReconciliation: func() (Result, error) {
+			return r.ExportReconciliation(ctx, "2016-01", "foo@example.org", CompressionGzip, nil)
+		},
+		OperationTypeExportReconciledTransactions: func() (Result, error) {
+			return r.ExportReconciledTransactions(ctx, "2016-01-01", "foo@example.org", CompressionGzip, nil)
+		},
+	}
+	for operationType, operation := range operations {
+		result, err := operation()
+		if err != nil {
+			t.Fatalf("%s: %v", operationType, err)
+		}
+		if id := result.StringValue(ParamIdentifier); id != "USD ACCOUNT" {
+			t.Errorf("%s: expected USD ACCOUNT, got %s", operationType, id)
+		}
+		if op := result.StringValue(ParamOperationType); op != operationType {
+			t.Errorf("%s: unexpected operation %s", operationType, op)
+		}
+	}
+
+	result, err := r.GetTransactionsByTransactionID(WithAccount(ctx, "eur"), []string{"A1"}, "foo@example.org", CompressionGzip)
+	if err != nil || result.StringValue(ParamIdentifier) != "EUR ACCOUNT" {
+		t.Errorf("unexpected result %v, error: %v", result, err)
+	}
+}
+
+func TestRegistryReusedIdentifier(t *testing.T) {
+	r := NewRegistry()
+	r.Register("old", SandboxUser("foo", "bar"))
+	b := r.Register("new", SandboxUser("foo", "baz"))
+	if a := r.AccountByIdentifier("foo"); a != b {
+		t.Fatalf("unexpected account: %v", a)
+	}
+
+	// replacing the old account must keep the identifier of the new one
+	r.Register("old", SandboxUser("qux", "bar"))
+	if a := r.AccountByIdentifier("foo"); a != b {
+		t.Errorf("unexpected account: %v", a)
+	}
+	if a := r.AccountByIdentifier("qux"); a != r.Account("old") {
+		t.Errorf("unexpected account: %v", a)
+	}
+}
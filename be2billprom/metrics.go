@@ -0,0 +1,117 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package be2billprom exposes the metrics of be2bill Direct Link clients
+to Prometheus.
+
+A Metrics is both a be2bill.Metrics recording the requests of the clients,
+and a prometheus.Collector registered like any other collector:
+
+	metrics := be2billprom.NewMetrics()
+	prometheus.MustRegister(metrics)
+
+	client := be2bill.NewDirectLinkClient(credentials)
+	client.Metrics = metrics
+
+The following metrics are exported, labelled by operation type and URL:
+
+	be2bill_requests_total            requests, also labelled by execution code category
+	be2bill_request_duration_seconds  histogram of the latency of the requests
+	be2bill_failovers_total           failed requests after which the next URL is tried
+	be2bill_timeouts_total            requests that timed out
+	be2bill_hash_errors_total         requests rejected because of an invalid hash
+*/
+package be2billprom
+
+import (
+	"time"
+
+	"github.com/noirotm/go-be2bill"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "be2bill"
+
+// Metrics is a be2bill.Metrics recording the requests as Prometheus metrics.
+type Metrics struct {
+	requests   *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	failovers  *prometheus.CounterVec
+	timeouts   *prometheus.CounterVec
+	hashErrors *prometheus.CounterVec
+}
+
+// NewMetrics returns a new Metrics, with the latency histograms using
+// be2bill.DefaultLatencyBuckets.
+func NewMetrics() *Metrics {
+	labels := []string{"operation", "url"}
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Number of requests sent to the be2bill servers, by execution code category.",
+		}, append(labels, "category")),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the requests sent to the be2bill servers.",
+			Buckets:   be2bill.DefaultLatencyBuckets,
+		}, labels),
+		failovers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failovers_total",
+			Help:      "Number of failed requests after which the next URL is tried.",
+		}, labels),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "timeouts_total",
+			Help:      "Number of requests that timed out.",
+		}, labels),
+		hashErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hash_errors_total",
+			Help:      "Number of requests rejected because of an invalid hash.",
+		}, labels),
+	}
+}
+
+func (p *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{p.requests, p.latency, p.failovers, p.timeouts, p.hashErrors}
+}
+
+// Describe implements prometheus.Collector.
+func (p *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range p.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (p *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range p.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// ObserveRequest records a request sent to a server.
+func (p *Metrics) ObserveRequest(operationType, url, category string, latency time.Duration) {
+	p.requests.WithLabelValues(operationType, url, category).Inc()
+	p.latency.WithLabelValues(operationType, url).Observe(latency.Seconds())
+}
+
+// IncFailover records a failover.
+func (p *Metrics) IncFailover(operationType, url string) {
+	p.failovers.WithLabelValues(operationType, url).Inc()
+}
+
+// IncTimeout records a timeout.
+func (p *Metrics) IncTimeout(operationType, url string) {
+	p.timeouts.WithLabelValues(operationType, url).Inc()
+}
+
+// IncHashError records a request rejected because of an invalid hash.
+func (p *Metrics) IncHashError(operationType, url string) {
+	p.hashErrors.WithLabelValues(operationType, url).Inc()
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/noirotm/go-be2bill"
+	"github.com/noirotm/go-be2bill/be2billtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	srv := be2billtest.NewServer("foo", "bar")
+	defer srv.Close()
+
+	m := NewMetrics()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+
+	// the wrong password makes the server reject the request
+	c := be2bill.NewDirectLinkClient(be2bill.User("foo", "baz", be2bill.Environment{failing.URL, srv.URL}))
+	c.Metrics = m
+	r, err := c.Capture("A1", "order_1", "desc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ExecCode() != be2bill.ExecCodeInvalidHash {
+		t.Fatalf("unexpected result: %v", r)
+	}
+
+	capture := be2bill.OperationTypeCapture
+	failingURL, url := failing.URL+"/front/service/rest/process", srv.URL+"/front/service/rest/process"
+	counters := []struct {
+		c        prometheus.Collector
+		expected float64
+	}{
+		{m.requests.WithLabelValues(capture, failingURL, be2bill.CategoryError), 1},
+		{m.requests.WithLabelValues(capture, url, "request error"), 1},
+		{m.failovers.WithLabelValues(capture, failingURL), 1},
+		{m.hashErrors.WithLabelValues(capture, url), 1},
+		{m.timeouts.WithLabelValues(capture, url), 0},
+	}
+	for i, counter := range counters {
+		if v := testutil.ToFloat64(counter.c); v != counter.expected {
+			t.Errorf("%d: want %v, got %v", i, counter.expected, v)
+		}
+	}
+
+	n, err := testutil.GatherAndCount(reg, "be2bill_request_duration_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("unexpected number of histograms: %d", n)
+	}
+	problems, err := testutil.GatherAndLint(reg)
+	if err != nil || len(problems) > 0 {
+		t.Errorf("lint failed: %v %v", err, problems)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"strings"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// cardPrefix is the prefix of the card numbers that choose the execution
+// code of their transactions.
+const cardPrefix = "400000000000"
+
+// These card numbers make the server return a specific execution code
+// for the transactions that use them.
+// Any other card number is accepted, as CardSuccess.
+const (
+	CardSuccess              = "4111111111111111"
+	Card3DSecure             = cardPrefix + "0001"
+	CardTransactionRefused   = cardPrefix + "4001"
+	CardInsufficientFunds    = cardPrefix + "4002"
+	CardRefused              = cardPrefix + "4003"
+	CardSuspectedFraud       = cardPrefix + "4005"
+	CardLost                 = cardPrefix + "4006"
+	CardStolen               = cardPrefix + "4007"
+	CardBankNetworkError     = cardPrefix + "5002"
+	CardRefusedByRiskRules   = cardPrefix + "6004"
+	CardInvalidCardData      = cardPrefix + "4012"
+	CardDuplicateTransaction = cardPrefix + "4011"
+)
+
+// CardNumber returns a card number for which the server answers with
+// the given execution code.
+// Card numbers made of 400000000000 followed by any four digit execution
+// code behave this way.
+func CardNumber(code be2bill.ExecCode) string {
+	return cardPrefix + string(code)
+}
+
+// cardExecCode returns the execution code of a transaction made
+// with the given card number.
+func cardExecCode(pan string) be2bill.ExecCode {
+	if len(pan) == len(cardPrefix)+4 && strings.HasPrefix(pan, cardPrefix) {
+		code := be2bill.ExecCode(pan[len(cardPrefix):])
+		if code.Category() != be2bill.ExecCodeCategoryUnknown {
+			return code
+		}
+	}
+	return be2bill.ExecCodeSuccess
+}
+
+var messages = map[be2bill.ExecCode]string{
+	be2bill.ExecCodeSuccess:                    "The transaction has been accepted.",
+	be2bill.ExecCode3DSecureRequired:           "The card holder must be authenticated.",
+	be2bill.ExecCodeMissingParameter:           "A parameter is missing.",
+	be2bill.ExecCodeInvalidParameter:           "A parameter is invalid.",
+	be2bill.ExecCodeInvalidHash:                "The HASH parameter is invalid.",
+	be2bill.ExecCodeUnsupportedProtocol:        "The protocol version is not supported.",
+	be2bill.ExecCodeAliasNotFound:              "The alias does not exist.",
+	be2bill.ExecCodeTransactionNotFound:        "The transaction does not exist.",
+	be2bill.ExecCodeTransactionNotRefundable:   "The transaction cannot be refunded.",
+	be2bill.ExecCodeAuthorizationNotCapturable: "The authorization cannot be captured.",
+	be2bill.ExecCodeInvalidCaptureAmount:       "The capture amount is invalid.",
+	be2bill.ExecCodeInvalidRefundAmount:        "The refund amount is invalid.",
+	be2bill.ExecCodeScheduleNotFound:           "The schedule does not exist.",
+	be2bill.ExecCodeInterruptedSchedule:        "The schedule has already been interrupted.",
+	be2bill.ExecCodeScheduleFinished:           "The schedule is already finished.",
+	be2bill.ExecCodeTransactionRefusedBank:     "The transaction has been refused by the bank.",
+	be2bill.ExecCodeUnsufficientFunds:          "The funds are insufficient.",
+	be2bill.ExecCodeCardRefused:                "The card has been refused by the bank.",
+	be2bill.ExecCodeBankNetworkError:           "A network error occurred with the bank.",
+}
+
+// message returns the message sent along with the given execution code.
+func message(code be2bill.ExecCode) string {
+	if m, ok := messages[code]; ok {
+		return m
+	}
+	return "Simulated execution code " + string(code) + "."
+}
@@ -0,0 +1,294 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// redirectHTML is the page returned when a 3-D Secure authentication
+// is required.
+const redirectHTML = `<html><body><p>3-D Secure authentication simulated by be2billtest.</p></body></html>`
+
+// descriptor is the descriptor of every transaction.
+const descriptor = "be2billtest"
+
+// yes is the value of enabled boolean parameters.
+const yes = "yes"
+
+// newTransaction records a new transaction for the given request.
+// The mutex must be held.
+func (s *Server) newTransaction(operationType string, params be2bill.Options, code be2bill.ExecCode, amount int) *Transaction {
+	s.lastID++
+	t := &Transaction{
+		TransactionID: fmt.Sprintf("A%06d", s.lastID),
+		OrderID:       stringParam(params, be2bill.ParamOrderID),
+		OperationType: operationType,
+		ExecCode:      code,
+		Amount:        amount,
+		Date:          s.now().UTC(),
+		Params:        params,
+	}
+	s.transactions[t.TransactionID] = t
+	s.ids = append(s.ids, t.TransactionID)
+	return t
+}
+
+// transactionResult returns the result of an operation that created
+// the given transaction.
+func transactionResult(t *Transaction) be2bill.Result {
+	result := newResult(t.OperationType, t.ExecCode)
+	result[be2bill.ResultParamTransactionID] = t.TransactionID
+	result[be2bill.ResultParamOrderID] = t.OrderID
+	result[be2bill.ResultParamAmount] = t.Amount
+	result[be2bill.ResultParamDescriptor] = descriptor
+	if t.Alias != "" {
+		result[be2bill.ResultParamAlias] = t.Alias
+	}
+	if t.CardCode != "" {
+		result[be2bill.ResultParamCardCode] = t.CardCode
+	}
+	if t.ScheduleID != "" {
+		result[be2bill.ParamScheduleID] = t.ScheduleID
+	}
+	if t.ThreeDSecure {
+		result[be2bill.ResultParam3DSecure] = yes
+	}
+	if t.ExecCode == be2bill.ExecCode3DSecureRequired {
+		result[be2bill.ResultParamRedirectHTML] = base64.StdEncoding.EncodeToString([]byte(redirectHTML))
+	}
+	return result
+}
+
+// parseAmount returns the amount in cents of the given parameter value.
+func parseAmount(value interface{}) (int, bool) {
+	s, _ := value.(string)
+	amount, err := strconv.Atoi(s)
+	return amount, err == nil && amount > 0
+}
+
+// parseInstallments returns the installments of a fragmented amount,
+// sorted by date.
+func parseInstallments(amounts be2bill.Options) ([]Installment, bool) {
+	if len(amounts) == 0 {
+		return nil, false
+	}
+
+	installments := make([]Installment, 0, len(amounts))
+	for date, value := range amounts {
+		amount, ok := parseAmount(value)
+		if !ok {
+			return nil, false
+		}
+		installments = append(installments, Installment{date, amount})
+	}
+	sort.Slice(installments, func(i, j int) bool {
+		return installments[i].Date < installments[j].Date
+	})
+	return installments, true
+}
+
+func (s *Server) payment(params be2bill.Options) be2bill.Result {
+	return s.transaction(be2bill.OperationTypePayment, params)
+}
+
+func (s *Server) authorization(params be2bill.Options) be2bill.Result {
+	return s.transaction(be2bill.OperationTypeAuthorization, params)
+}
+
+func (s *Server) credit(params be2bill.Options) be2bill.Result {
+	return s.transaction(be2bill.OperationTypeCredit, params)
+}
+
+// transaction performs a Direct Link operation using card holder
+// information or an alias.
+func (s *Server) transaction(operationType string, params be2bill.Options) be2bill.Result {
+	if !hasParams(params, be2bill.ParamOrderID, be2bill.ParamClientIdent, be2bill.ParamClientEmail,
+		be2bill.ParamClientIP, be2bill.ParamDescription, be2bill.ParamClientUserAgent) {
+		return newResult(operationType, be2bill.ExecCodeMissingParameter)
+	}
+
+	t, code := s.cardTransaction(operationType, params, false)
+	if t == nil {
+		return newResult(operationType, code)
+	}
+	return transactionResult(t)
+}
+
+// cardTransaction creates a transaction using card holder information
+// or an alias, and returns a copy of it.
+// If the request is invalid, no transaction is created and the execution
+// code of the error is returned instead.
+//
+// Interactive transactions are made by a customer who can authenticate
+// using 3-D Secure, so they succeed instead of requiring an authentication.
+func (s *Server) cardTransaction(operationType string, params be2bill.Options, interactive bool) (*Transaction, be2bill.ExecCode) {
+	// only payments support fragmented amounts
+	var amount int
+	var installments []Installment
+	if amounts, ok := params[be2bill.ParamAmounts].(be2bill.Options); ok {
+		if operationType != be2bill.OperationTypePayment {
+			return nil, be2bill.ExecCodeInvalidParameter
+		}
+		if installments, ok = parseInstallments(amounts); !ok {
+			return nil, be2bill.ExecCodeInvalidParameter
+		}
+		amount = installments[0].Amount
+	} else {
+		if !hasParams(params, be2bill.ParamAmount) {
+			return nil, be2bill.ExecCodeMissingParameter
+		}
+		if amount, ok = parseAmount(params[be2bill.ParamAmount]); !ok {
+			return nil, be2bill.ExecCodeInvalidParameter
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alias := stringParam(params, be2bill.ParamAlias)
+	pan := stringParam(params, be2bill.ParamCardCode)
+	if alias != "" {
+		var ok bool
+		if pan, ok = s.aliases[alias]; !ok {
+			return nil, be2bill.ExecCodeAliasNotFound
+		}
+	} else if !hasParams(params, be2bill.ParamCardCode, be2bill.ParamCardValidityDate,
+		be2bill.ParamCardCVV, be2bill.ParamCardFullName) {
+		return nil, be2bill.ExecCodeMissingParameter
+	}
+
+	code := cardExecCode(pan)
+	threeDSecure := code == be2bill.ExecCode3DSecureRequired
+	if threeDSecure && interactive {
+		code = be2bill.ExecCodeSuccess
+	}
+
+	t := s.newTransaction(operationType, params, code, amount)
+	t.CardCode = be2bill.MaskCardCode(pan)
+	t.Alias = alias
+	t.ThreeDSecure = threeDSecure
+
+	if code == be2bill.ExecCodeSuccess {
+		// be2bill uses the identifier of the transaction as alias
+		if alias == "" && stringParam(params, be2bill.ParamCreateAlias) == yes {
+			t.Alias = t.TransactionID
+			s.aliases[t.Alias] = pan
+		}
+
+		if installments != nil {
+			schedule := &Schedule{
+				ScheduleID:    "S" + t.TransactionID[1:],
+				TransactionID: t.TransactionID,
+				Installments:  installments,
+			}
+			s.schedules[schedule.ScheduleID] = schedule
+			t.ScheduleID = schedule.ScheduleID
+		}
+	}
+
+	c := *t
+	return &c, ""
+}
+
+func (s *Server) capture(params be2bill.Options) be2bill.Result {
+	const operationType = be2bill.OperationTypeCapture
+	if !hasParams(params, be2bill.ParamTransactionID, be2bill.ParamOrderID, be2bill.ParamDescription) {
+		return newResult(operationType, be2bill.ExecCodeMissingParameter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.transactions[stringParam(params, be2bill.ParamTransactionID)]
+	if !ok {
+		return newResult(operationType, be2bill.ExecCodeTransactionNotFound)
+	}
+	if auth.OperationType != be2bill.OperationTypeAuthorization || auth.ExecCode != be2bill.ExecCodeSuccess || auth.Captured {
+		return newResult(operationType, be2bill.ExecCodeAuthorizationNotCapturable)
+	}
+
+	// partial captures replace the authorized amount
+	amount := auth.Amount
+	if _, ok := params[be2bill.ParamAmount]; ok {
+		if amount, ok = parseAmount(params[be2bill.ParamAmount]); !ok || amount > auth.Amount {
+			return newResult(operationType, be2bill.ExecCodeInvalidCaptureAmount)
+		}
+	}
+
+	auth.Captured = true
+	t := s.newTransaction(operationType, params, be2bill.ExecCodeSuccess, amount)
+	t.ParentID = auth.TransactionID
+	t.CardCode = auth.CardCode
+	t.Alias = auth.Alias
+
+	return transactionResult(t)
+}
+
+func (s *Server) refund(params be2bill.Options) be2bill.Result {
+	const operationType = be2bill.OperationTypeRefund
+	if !hasParams(params, be2bill.ParamTransactionID, be2bill.ParamOrderID, be2bill.ParamDescription) {
+		return newResult(operationType, be2bill.ExecCodeMissingParameter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orig, ok := s.transactions[stringParam(params, be2bill.ParamTransactionID)]
+	if !ok {
+		return newResult(operationType, be2bill.ExecCodeTransactionNotFound)
+	}
+	if orig.OperationType != be2bill.OperationTypePayment && orig.OperationType != be2bill.OperationTypeCapture ||
+		orig.ExecCode != be2bill.ExecCodeSuccess || orig.Refunded >= orig.Amount {
+		return newResult(operationType, be2bill.ExecCodeTransactionNotRefundable)
+	}
+
+	// partial refunds can be made until the whole amount is refunded
+	remaining := orig.Amount - orig.Refunded
+	amount := remaining
+	if _, ok := params[be2bill.ParamAmount]; ok {
+		if amount, ok = parseAmount(params[be2bill.ParamAmount]); !ok || amount > remaining {
+			return newResult(operationType, be2bill.ExecCodeInvalidRefundAmount)
+		}
+	}
+
+	orig.Refunded += amount
+	t := s.newTransaction(operationType, params, be2bill.ExecCodeSuccess, amount)
+	t.ParentID = orig.TransactionID
+	t.CardCode = orig.CardCode
+	t.Alias = orig.Alias
+
+	return transactionResult(t)
+}
+
+func (s *Server) stopNTimes(params be2bill.Options) be2bill.Result {
+	const operationType = be2bill.OperationTypeStopNTimes
+	if !hasParams(params, be2bill.ParamScheduleID) {
+		return newResult(operationType, be2bill.ExecCodeMissingParameter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[stringParam(params, be2bill.ParamScheduleID)]
+	if !ok {
+		return newResult(operationType, be2bill.ExecCodeScheduleNotFound)
+	}
+	if schedule.Stopped {
+		return newResult(operationType, be2bill.ExecCodeInterruptedSchedule)
+	}
+	last := schedule.Installments[len(schedule.Installments)-1]
+	if last.Date < s.now().Format("2006-01-02") {
+		return newResult(operationType, be2bill.ExecCodeScheduleFinished)
+	}
+
+	schedule.Stopped = true
+	return newResult(operationType, be2bill.ExecCodeSuccess)
+}
@@ -0,0 +1,250 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// exportColumns are the columns of the generated export files.
+var exportColumns = []string{
+	be2bill.ParamTransactionID,
+	be2bill.ParamOrderID,
+	be2bill.ParamDate,
+	be2bill.ParamOperationType,
+	be2bill.ExportColumnExecCode,
+	be2bill.ExportColumnMessage,
+	be2bill.ParamAmount,
+	be2bill.ExportColumnCurrency,
+	be2bill.ParamAlias,
+	be2bill.ParamClientIdent,
+	be2bill.ParamClientEmail,
+	be2bill.ParamDescription,
+	be2bill.ParamCardCode,
+}
+
+// An Export represents an export requested to the server.
+type Export struct {
+	OperationType string
+	// Params are the parameters of the request.
+	Params be2bill.Options
+	// Transactions are the exported transactions.
+	Transactions []Transaction
+	// Delivered is true if the file was accepted by the callback URL.
+	Delivered bool
+	// Err is the error that occurred while delivering the file to
+	// the callback URL, if any.
+	Err error
+}
+
+// export performs the export and transaction search operations.
+// If a callback URL is given, the file is sent to it before the result
+// is returned.
+// Files are compressed using gzip or zip, as requested, and bzip2
+// compressed files are sent uncompressed instead.
+// There are never any chargebacks to export.
+func (s *Server) export(params be2bill.Options) be2bill.Result {
+	operationType := stringParam(params, be2bill.ParamOperationType)
+	if !hasParams(params, be2bill.ParamCallbackURL) && !hasParams(params, be2bill.ParamMailTo) {
+		return newResult(operationType, be2bill.ExecCodeMissingParameter)
+	}
+	if operationType != be2bill.OperationTypeGetTransactions &&
+		!hasParams(params, be2bill.ParamDate) && !hasParams(params, be2bill.ParamStartDate, be2bill.ParamEndDate) {
+		return newResult(operationType, be2bill.ExecCodeMissingParameter)
+	}
+
+	s.mu.Lock()
+	e := &Export{
+		OperationType: operationType,
+		Params:        params,
+		Transactions:  s.exportedTransactions(params),
+	}
+	s.exports = append(s.exports, e)
+	s.mu.Unlock()
+
+	if operationType == be2bill.OperationTypeGetTransactions && len(e.Transactions) == 0 {
+		return newResult(operationType, be2bill.ExecCodeTransactionNotFound)
+	}
+
+	if callbackURL := stringParam(params, be2bill.ParamCallbackURL); callbackURL != "" {
+		err := s.deliver(callbackURL, e)
+
+		s.mu.Lock()
+		e.Delivered = err == nil
+		e.Err = err
+		s.mu.Unlock()
+	}
+
+	result := newResult(operationType, be2bill.ExecCodeSuccess)
+	result[be2bill.ResultParamDescriptor] = descriptor
+	return result
+}
+
+// exportedTransactions returns the transactions matching the export request.
+// The mutex must be held.
+func (s *Server) exportedTransactions(params be2bill.Options) []Transaction {
+	operationType := stringParam(params, be2bill.ParamOperationType)
+	if operationType == be2bill.OperationTypeExportChargebacks {
+		return nil
+	}
+
+	var ids map[string]bool
+	if operationType == be2bill.OperationTypeGetTransactions {
+		ids = make(map[string]bool)
+		for _, name := range []string{be2bill.ParamTransactionID, be2bill.ParamOrderID} {
+			for _, id := range strings.Split(stringParam(params, name), ";") {
+				if id != "" {
+					ids[name+"="+id] = true
+				}
+			}
+		}
+	}
+
+	date := stringParam(params, be2bill.ParamDate)
+	startDate := stringParam(params, be2bill.ParamStartDate)
+	endDate := stringParam(params, be2bill.ParamEndDate)
+
+	var list []Transaction
+	for _, id := range s.ids {
+		t := s.transactions[id]
+		day := t.Date.Format("2006-01-02")
+
+		switch {
+		case ids != nil:
+			if !ids[be2bill.ParamTransactionID+"="+t.TransactionID] && !ids[be2bill.ParamOrderID+"="+t.OrderID] {
+				continue
+			}
+		case date != "":
+			if !strings.HasPrefix(day, date) {
+				continue
+			}
+		default:
+			if day < startDate || truncate(day, len(endDate)) > endDate {
+				continue
+			}
+		}
+
+		// reconciliations only list the collected transactions
+		if operationType == be2bill.OperationTypeExportReconciliation ||
+			operationType == be2bill.OperationTypeExportReconciledTransactions {
+			if t.ExecCode != be2bill.ExecCodeSuccess ||
+				t.OperationType != be2bill.OperationTypePayment && t.OperationType != be2bill.OperationTypeCapture {
+				continue
+			}
+		}
+
+		list = append(list, *t)
+	}
+	return list
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// deliver sends the export file to the given callback URL.
+func (s *Server) deliver(callbackURL string, e *Export) error {
+	var file bytes.Buffer
+	compression := strings.ToUpper(stringParam(e.Params, be2bill.ParamCompression))
+	if err := writeExport(&file, compression, e.Transactions); err != nil {
+		return err
+	}
+	if compression != be2bill.CompressionGzip && compression != be2bill.CompressionZip {
+		compression = ""
+	}
+
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set(be2bill.ParamOperationType, e.OperationType)
+	query.Set(be2bill.ParamIdentifier, stringParam(e.Params, be2bill.ParamIdentifier))
+	for _, name := range []string{be2bill.ParamDate, be2bill.ParamStartDate, be2bill.ParamEndDate} {
+		if value := stringParam(e.Params, name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	if compression != "" {
+		query.Set(be2bill.ParamCompression, compression)
+	}
+	u.RawQuery = query.Encode()
+
+	resp, err := s.httpClient().Post(u.String(), "application/octet-stream", &file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("callback URL answered %s", resp.Status)
+	}
+	return nil
+}
+
+// writeExport writes the given transactions as a CSV file, using
+// the given compression format.
+func writeExport(w io.Writer, compression string, transactions []Transaction) error {
+	switch compression {
+	case be2bill.CompressionGzip:
+		gw := gzip.NewWriter(w)
+		if err := writeCSV(gw, transactions); err != nil {
+			return err
+		}
+		return gw.Close()
+	case be2bill.CompressionZip:
+		zw := zip.NewWriter(w)
+		f, err := zw.Create("export.csv")
+		if err != nil {
+			return err
+		}
+		if err := writeCSV(f, transactions); err != nil {
+			return err
+		}
+		return zw.Close()
+	}
+	return writeCSV(w, transactions)
+}
+
+func writeCSV(w io.Writer, transactions []Transaction) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	_ = cw.Write(exportColumns)
+
+	for _, t := range transactions {
+		_ = cw.Write([]string{
+			t.TransactionID,
+			t.OrderID,
+			t.Date.Format("2006-01-02 15:04:05"),
+			t.OperationType,
+			string(t.ExecCode),
+			message(t.ExecCode),
+			strconv.Itoa(t.Amount),
+			"EUR",
+			t.Alias,
+			stringParam(t.Params, be2bill.ParamClientIdent),
+			stringParam(t.Params, be2bill.ParamClientEmail),
+			stringParam(t.Params, be2bill.ParamDescription),
+			t.CardCode,
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
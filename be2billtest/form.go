@@ -0,0 +1,316 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// notificationAcknowledgement is the response body expected from
+// the merchant once a notification has been processed.
+const notificationAcknowledgement = "OK"
+
+// cardParams are the fields of the card page.
+var cardParams = []string{
+	be2bill.ParamCardCode,
+	be2bill.ParamCardValidityDate,
+	be2bill.ParamCardCVV,
+	be2bill.ParamCardFullName,
+}
+
+var cardPageTemplate = template.Must(template.New("card").Parse(`<!DOCTYPE html>
+<html>
+<head><title>be2billtest payment page</title></head>
+<body>
+<p>{{.Description}}</p>
+<form method="post" action="{{.Action}}">{{range .Hidden}}
+  <input type="hidden" name="{{.Name}}" value="{{.Value}}" />{{end}}
+  <input type="text" name="CARDCODE" placeholder="Card number" />
+  <input type="text" name="CARDVALIDITYDATE" placeholder="MM-YY" />
+  <input type="text" name="CARDCVV" placeholder="CVV" />
+  <input type="text" name="CARDFULLNAME" placeholder="Card holder" />
+  <input type="submit" value="Pay" />
+</form>
+</body>
+</html>
+`))
+
+var resultPageTemplate = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html>
+<head><title>be2billtest payment result</title></head>
+<body>
+<p>{{.EXECCODE}}: {{.MESSAGE}}</p>
+</body>
+</html>
+`))
+
+type hiddenField struct {
+	Name  string
+	Value string
+}
+
+// A Notification represents a notification sent to NotificationURL.
+type Notification struct {
+	// Params are the signed parameters of the notification.
+	Params be2bill.Options
+	// Delivered is true if the notification was acknowledged.
+	Delivered bool
+	// Err is the error that occurred while sending the notification, if any.
+	Err error
+}
+
+// serveForm implements the hosted payment page.
+//
+// The signed form rendered by a FormClient is answered with a page asking
+// for the card holder information. Once it is submitted, the transaction
+// is made, a notification is sent to NotificationURL and the customer is
+// redirected to ReturnURL.
+func (s *Server) serveForm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// the card holder information is not part of the signed form
+	params := be2bill.ParseOptions(r.PostForm)
+	card := be2bill.Options{}
+	for _, name := range cardParams {
+		if value, ok := params[name]; ok {
+			card[name] = value
+			delete(params, name)
+		}
+	}
+
+	operationType := stringParam(params, be2bill.ParamOperationType)
+	if operationType != be2bill.OperationTypePayment && operationType != be2bill.OperationTypeAuthorization {
+		formError(w, be2bill.ExecCodeInvalidParameter)
+		return
+	}
+	if code := s.verify(operationType, params); code != "" {
+		formError(w, code)
+		return
+	}
+	if !hasParams(params, be2bill.ParamOrderID, be2bill.ParamClientIdent, be2bill.ParamDescription) {
+		formError(w, be2bill.ExecCodeMissingParameter)
+		return
+	}
+
+	if len(card) == 0 {
+		renderCardPage(w, r.PostForm)
+		return
+	}
+
+	for k, v := range card {
+		params[k] = v
+	}
+	t, code := s.cardTransaction(operationType, params, true)
+	if t == nil {
+		formError(w, code)
+		return
+	}
+
+	result := s.notificationParams(t)
+	s.notify(result)
+
+	if s.ReturnURL == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = resultPageTemplate.Execute(w, result)
+		return
+	}
+
+	u, err := url.Parse(s.ReturnURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	query := u.Query()
+	for k, v := range result {
+		query.Set(k, v.(string))
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// formError answers a form that cannot be processed.
+func formError(w http.ResponseWriter, code be2bill.ExecCode) {
+	http.Error(w, string(code)+": "+message(code), http.StatusBadRequest)
+}
+
+// renderCardPage renders the page asking for the card holder information,
+// which carries the fields of the signed form.
+func renderCardPage(w http.ResponseWriter, form url.Values) {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hidden := make([]hiddenField, len(names))
+	for i, name := range names {
+		hidden[i] = hiddenField{name, form.Get(name)}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = cardPageTemplate.Execute(w, struct {
+		Action      string
+		Description string
+		Hidden      []hiddenField
+	}{formPath, form.Get(be2bill.ParamDescription), hidden})
+}
+
+// notificationParams returns the signed parameters sent to the merchant
+// for the given transaction.
+func (s *Server) notificationParams(t *Transaction) be2bill.Options {
+	threeDSecure := "no"
+	if t.ThreeDSecure {
+		threeDSecure = yes
+	}
+
+	params := be2bill.Options{
+		be2bill.ParamIdentifier:       s.identifier,
+		be2bill.ParamOperationType:    t.OperationType,
+		be2bill.ParamTransactionID:    t.TransactionID,
+		be2bill.ParamOrderID:          t.OrderID,
+		be2bill.ResultParamExecCode:   string(t.ExecCode),
+		be2bill.ResultParamMessage:    message(t.ExecCode),
+		be2bill.ParamAmount:           strconv.Itoa(t.Amount),
+		be2bill.ResultParamDescriptor: descriptor,
+		be2bill.ParamCardCode:         t.CardCode,
+		be2bill.Param3DSecure:         threeDSecure,
+		be2bill.ParamVersion:          be2bill.APIVersion,
+	}
+	for _, name := range []string{be2bill.ParamClientIdent, be2bill.ParamClientEmail, be2bill.ParamExtraData} {
+		if value := stringParam(t.Params, name); value != "" {
+			params[name] = value
+		}
+	}
+	if t.Alias != "" {
+		params[be2bill.ParamAlias] = t.Alias
+	}
+	if t.ScheduleID != "" {
+		params[be2bill.ParamScheduleID] = t.ScheduleID
+	}
+
+	params[be2bill.ParamHash] = s.Hasher.ComputeHash(s.password, params)
+	return params
+}
+
+// notify sends the given parameters to NotificationURL, if any.
+func (s *Server) notify(params be2bill.Options) {
+	if s.NotificationURL == "" {
+		return
+	}
+
+	n := &Notification{Params: params}
+	n.Err = s.postNotification(params)
+	n.Delivered = n.Err == nil
+
+	s.mu.Lock()
+	s.notes = append(s.notes, n)
+	s.mu.Unlock()
+}
+
+func (s *Server) postNotification(params be2bill.Options) error {
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v.(string))
+	}
+
+	resp, err := s.httpClient().PostForm(s.NotificationURL, values)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("notification URL answered %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return err
+	}
+	if string(body) != notificationAcknowledgement {
+		return fmt.Errorf("unexpected acknowledgement %q", body)
+	}
+	return nil
+}
+
+var (
+	formActionRegexp  = regexp.MustCompile(`<form[^>]* action="([^"]*)"`)
+	hiddenInputRegexp = regexp.MustCompile(`<input type="hidden" name="([^"]*)" value="([^"]*)" />`)
+)
+
+// parseHTMLForm returns the action and the hidden fields of the form
+// in the given HTML code.
+func parseHTMLForm(code string) (string, url.Values, error) {
+	m := formActionRegexp.FindStringSubmatch(code)
+	if m == nil {
+		return "", nil, errors.New("be2billtest: no form found")
+	}
+
+	values := url.Values{}
+	for _, input := range hiddenInputRegexp.FindAllStringSubmatch(code, -1) {
+		values.Set(html.UnescapeString(input[1]), html.UnescapeString(input[2]))
+	}
+	return html.UnescapeString(m[1]), values, nil
+}
+
+// Checkout simulates a customer paying with the given card using
+// the payment or authorization form rendered by a be2bill.FormClient
+// for this server.
+//
+// The form is submitted to the hosted payment page, then the card page
+// is filled and submitted in turn. The response of the last request is
+// returned, which is the page of ReturnURL if the client follows redirects.
+func (s *Server) Checkout(client *http.Client, form string, card be2bill.Card) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	action, values, err := parseHTMLForm(form)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.PostForm(action, values)
+	if err != nil {
+		return nil, err
+	}
+	page, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("be2billtest: payment page answered %s: %s", resp.Status, strings.TrimSpace(string(page)))
+	}
+
+	action, values, err = parseHTMLForm(string(page))
+	if err != nil {
+		return nil, err
+	}
+	values.Set(be2bill.ParamCardCode, card.PAN)
+	values.Set(be2bill.ParamCardValidityDate, card.ValidityDate)
+	values.Set(be2bill.ParamCardCVV, card.CVV)
+	values.Set(be2bill.ParamCardFullName, card.FullName)
+
+	return client.PostForm(s.URL+action, values)
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// newMerchant returns a merchant website serving the notification and
+// return pages of the given server.
+func newMerchant(srv *Server, notified *[]be2bill.Result) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/notification", be2bill.NewNotificationHandler(srv.Credentials(), func(r *http.Request, result be2bill.Result) error {
+		*notified = append(*notified, result)
+		return nil
+	}))
+	mux.Handle("/return", be2bill.NewReturnHandler(
+		srv.Credentials(),
+		func(w http.ResponseWriter, r *http.Request, result be2bill.Result) {
+			fmt.Fprint(w, "success ", result.TransactionID())
+		},
+		func(w http.ResponseWriter, r *http.Request, result be2bill.Result) {
+			fmt.Fprint(w, "failure ", result.ExecCode())
+		},
+	))
+	merchant := httptest.NewServer(mux)
+
+	srv.ReturnURL = merchant.URL + "/return"
+	srv.NotificationURL = merchant.URL + "/notification"
+	return merchant
+}
+
+func TestServerCheckout(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	var notified []be2bill.Result
+	merchant := newMerchant(srv, &notified)
+	defer merchant.Close()
+
+	cases := []struct {
+		pan  string
+		page string
+	}{
+		{CardSuccess, "success A000001"},
+		{Card3DSecure, "success A000002"},
+		{CardRefused, "failure 4003"},
+	}
+
+	c := be2bill.NewFormClient(srv.Credentials())
+	for _, tc := range cases {
+		form := c.BuildPaymentFormButton(be2bill.SingleAmount(1500), "order_"+tc.pan, "client_1", "Fashion jacket", nil, nil)
+		resp, err := srv.Checkout(nil, form, testCard(tc.pan))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(body) != tc.page {
+			t.Errorf("card %s: want %q, got %q", tc.pan, tc.page, body)
+		}
+	}
+
+	if len(notified) != len(cases) {
+		t.Fatalf("unexpected notifications: %v", notified)
+	}
+	if notified[0].OrderID() != "order_"+CardSuccess || notified[0].Transaction().Amount != 1500 {
+		t.Errorf("unexpected notification: %v", notified[0])
+	}
+	if !notified[1].Transaction().ThreeDSecure {
+		t.Errorf("unexpected notification: %v", notified[1])
+	}
+	for _, n := range srv.Notifications() {
+		if !n.Delivered {
+			t.Errorf("notification not delivered: %v", n.Err)
+		}
+	}
+}
+
+func TestServerCheckoutFragmented(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewFormClient(srv.Credentials())
+	form := c.BuildPaymentFormButton(be2bill.FragmentedAmount{"2016-01-01": 1000, "2016-02-01": 2000}, "order_1", "client_1", "desc", nil, nil)
+	resp, err := srv.Checkout(nil, form, testCard(CardSuccess))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "0000") {
+		t.Errorf("unexpected result page: %s", body)
+	}
+
+	tr := srv.Transactions()
+	if len(tr) != 1 || tr[0].ScheduleID == "" {
+		t.Fatalf("unexpected transactions: %+v", tr)
+	}
+	if schedule, _ := srv.Schedule(tr[0].ScheduleID); len(schedule.Installments) != 2 {
+		t.Errorf("unexpected schedule: %+v", schedule)
+	}
+}
+
+func TestServerCheckoutInvalidHash(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewFormClient(be2bill.User("foo", "wrong", srv.Environment()))
+	form := c.BuildAuthorizationFormButton(1500, "order_1", "client_1", "desc", nil, nil)
+	_, err := srv.Checkout(nil, form, testCard(CardSuccess))
+	if err == nil || !strings.Contains(err.Error(), string(be2bill.ExecCodeInvalidHash)) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(srv.Transactions()) != 0 {
+		t.Error("unexpected transaction")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// maskedValue replaces the value of the parameters that cannot be stored.
+const maskedValue = "MASKED"
+
+// A Fixture is a request/response pair saved by a Recorder.
+type Fixture struct {
+	OperationType string `json:"operationType"`
+	OrderID       string `json:"orderId,omitempty"`
+	Path          string `json:"path"`
+	// Params are the parameters of the request, with nested names such as
+	// AMOUNTS[2016-05-14], and sensitive values masked.
+	Params     map[string]string `json:"params"`
+	StatusCode int               `json:"statusCode"`
+	Body       string            `json:"body"`
+}
+
+// readFixtureRequest returns a fixture holding the masked parameters
+// of the given request, and restores the body of the request.
+func readFixtureRequest(req *http.Request) (*Fixture, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{
+		OperationType: values.Get("method"),
+		Path:          req.URL.Path,
+		Params:        make(map[string]string),
+	}
+	for name, value := range values {
+		if !strings.HasPrefix(name, "params[") || len(value) == 0 {
+			continue
+		}
+		// params[AMOUNTS][2016-05-14] is saved as AMOUNTS[2016-05-14]
+		name = strings.Replace(strings.TrimPrefix(name, "params["), "]", "", 1)
+		f.Params[name] = maskParam(name, value[0])
+	}
+	f.OrderID = f.Params[be2bill.ParamOrderID]
+	return f, nil
+}
+
+// maskParam returns the value of the given parameter, masked if it
+// contains card data, an alias usable to charge the card, or is derived
+// from the account password.
+// Card numbers are masked by be2bill.MaskCardCode, like in the logs
+// of the clients.
+func maskParam(name, value string) string {
+	switch name {
+	case be2bill.ParamCardCode:
+		return be2bill.MaskCardCode(value)
+	case be2bill.ParamCardCVV, be2bill.ParamCardValidityDate, be2bill.ParamCardFullName,
+		be2bill.ParamHash, be2bill.ParamAlias:
+		return maskedValue
+	}
+	return value
+}
+
+// maskResponse returns the given response body with its parameters
+// masked as by maskParam and the card numbers found in the other values
+// masked, or with its card numbers masked if it is not a JSON object.
+func maskResponse(body []byte) string {
+	var result map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&result); err != nil {
+		return be2bill.MaskCardData(string(body))
+	}
+
+	maskValues(result)
+	data, err := json.Marshal(result)
+	if err != nil {
+		return be2bill.MaskCardData(string(body))
+	}
+	return string(data)
+}
+
+// maskValues masks the string values of the given JSON object, and of
+// the objects nested in it.
+func maskValues(m map[string]interface{}) {
+	for k, v := range m {
+		switch value := v.(type) {
+		case string:
+			switch k {
+			case be2bill.ParamOrderID, be2bill.ParamTransactionID:
+				// identifiers are kept to match the replayed requests
+			default:
+				m[k] = be2bill.MaskCardData(maskParam(k, value))
+			}
+		case map[string]interface{}:
+			maskValues(value)
+		}
+	}
+}
+
+// fixtureName returns a file name for the given fixture, prefixed by
+// its sequence number so that fixtures are replayed in recording order.
+func fixtureName(seq int, f *Fixture) string {
+	name := fmt.Sprintf("%04d_%s_%s", seq, f.OperationType, f.OrderID)
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	return strings.TrimRight(name, "_") + ".json"
+}
+
+// A Recorder is an http.RoundTripper that sends the requests of
+// a DirectLinkClient using another RoundTripper, and saves every
+// request/response pair as a fixture file so it can be replayed later
+// by a Replayer.
+//
+// Card numbers are masked, and card cryptograms, hashes and aliases are
+// never written, in the requests as well as in the responses.
+type Recorder struct {
+	dir       string
+	transport http.RoundTripper
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecorder returns a new Recorder writing fixtures in the given
+// directory, and sending requests using transport.
+// If transport is nil, http.DefaultTransport is used.
+func NewRecorder(dir string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{
+		dir:       dir,
+		transport: transport,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (p *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	f, err := readFixtureRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	f.StatusCode = resp.StatusCode
+	f.Body = maskResponse(body)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return nil, err
+	}
+	p.seq++
+	if err := ioutil.WriteFile(filepath.Join(p.dir, fixtureName(p.seq, f)), data, 0644); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// An UnmatchedRequestError is returned by a Replayer when no fixture
+// is left for a request.
+type UnmatchedRequestError struct {
+	OperationType string
+	OrderID       string
+}
+
+func (e *UnmatchedRequestError) Error() string {
+	return fmt.Sprintf("be2billtest: no fixture for operation %q and order %q", e.OperationType, e.OrderID)
+}
+
+// A Replayer is an http.RoundTripper that answers the requests of
+// a DirectLinkClient with the fixtures saved by a Recorder, without
+// any network access.
+//
+// Requests are matched by operation type and ORDERID. Fixtures with the same
+// operation type and ORDERID are replayed in recording order, and each of
+// them is used once. Requests for which no fixture is left fail with
+// an *UnmatchedRequestError.
+type Replayer struct {
+	mu       sync.Mutex
+	fixtures map[string][]*Fixture
+}
+
+func fixtureKey(operationType, orderID string) string {
+	return operationType + "\x00" + orderID
+}
+
+// NewReplayer returns a new Replayer serving the fixtures found in
+// the given directory.
+func NewReplayer(dir string) (*Replayer, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	p := &Replayer{fixtures: make(map[string][]*Fixture)}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		f := &Fixture{}
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, fmt.Errorf("be2billtest: %s: %v", name, err)
+		}
+		key := fixtureKey(f.OperationType, f.OrderID)
+		p.fixtures[key] = append(p.fixtures[key], f)
+	}
+	return p, nil
+}
+
+// Remaining returns the number of fixtures that have not been replayed.
+func (p *Replayer) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, list := range p.fixtures {
+		n += len(list)
+	}
+	return n
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (p *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer func() { _ = req.Body.Close() }()
+	}
+
+	r, err := readFixtureRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	key := fixtureKey(r.OperationType, r.OrderID)
+	list := p.fixtures[key]
+	if len(list) == 0 {
+		p.mu.Unlock()
+		return nil, &UnmatchedRequestError{r.OperationType, r.OrderID}
+	}
+	f := list[0]
+	p.fixtures[key] = list[1:]
+	p.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}, nil
+}
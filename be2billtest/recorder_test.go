@@ -0,0 +1,170 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "be2billtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	srv := NewServer("foo", "bar")
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	c.HTTPClient = &http.Client{Transport: NewRecorder(dir, nil)}
+
+	card := testCard(CardSuccess)
+	auth, err := c.ProcessAuthorization(context.Background(), &be2bill.AuthorizationRequest{
+		Card:   card,
+		Amount: 1000,
+		Order:  testOrder("order_1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	capture, err := c.Capture(auth.TransactionID(), "order_1", "desc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	// sensitive values must not be written
+	names, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(names) != 2 {
+		t.Fatalf("unexpected fixtures: %v", names)
+	}
+	data, _ := ioutil.ReadFile(names[0])
+	for _, s := range []string{card.PAN, `"` + card.CVV + `"`, `"` + card.ValidityDate + `"`, card.FullName, "bar"} {
+		if strings.Contains(string(data), s) {
+			t.Errorf("fixture contains %q: %s", s, data)
+		}
+	}
+
+	// replay without any server
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = be2bill.NewDirectLinkClient(be2bill.User("foo", "bar", be2bill.EnvSandbox))
+	c.HTTPClient = &http.Client{Transport: replayer}
+
+	r, err := c.ProcessAuthorization(context.Background(), &be2bill.AuthorizationRequest{
+		Card:   card,
+		Amount: 1000,
+		Order:  testOrder("order_1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TransactionID() != auth.TransactionID() || !r.Success() {
+		t.Errorf("unexpected replayed authorization: %v", r)
+	}
+	r, err = c.Capture(auth.TransactionID(), "order_1", "desc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TransactionID() != capture.TransactionID() {
+		t.Errorf("unexpected replayed capture: %v", r)
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("unexpected remaining fixtures: %d", replayer.Remaining())
+	}
+
+	// every fixture is used once
+	_, err = c.Capture(auth.TransactionID(), "order_1", "desc", nil)
+	var unmatched *UnmatchedRequestError
+	if !errors.As(err, &unmatched) || unmatched.OperationType != be2bill.OperationTypeCapture {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// transportFunc is an http.RoundTripper calling the function.
+type transportFunc func(r *http.Request) (*http.Response, error)
+
+func (f transportFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRecorderMasksResponse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "be2billtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	const pan = "4111111111111111"
+	body := `{"OPERATIONTYPE":"payment","EXECCODE":"1001","ORDERID":"order_1","ALIAS":"A1234",` +
+		`"CARDCODE":"` + pan + `","CARDCVV":"987","HASH":"0123456789abcdef",` +
+		`"MESSAGE":"invalid request CARDCODE=` + pan + `"}`
+	transport := transportFunc(func(r *http.Request) (*http.Response, error) {
+		// the request body can be read again
+		rc, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		data, _ := ioutil.ReadAll(rc)
+		if !strings.Contains(string(data), "order_1") {
+			t.Errorf("unexpected request body: %s", data)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	c := be2bill.NewDirectLinkClient(be2bill.User("foo", "bar", be2bill.EnvSandbox))
+	c.HTTPClient = &http.Client{Transport: NewRecorder(dir, transport)}
+	r, err := c.ProcessPayment(context.Background(), &be2bill.PaymentRequest{
+		Card:   testCard(pan),
+		Amount: be2bill.SingleAmount(1000),
+		Order:  testOrder("order_1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the client still gets the actual response
+	if r.Alias() != "A1234" {
+		t.Errorf("unexpected result: %v", r)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(names) != 1 {
+		t.Fatalf("unexpected fixtures: %v", names)
+	}
+	data, _ := ioutil.ReadFile(names[0])
+	for _, s := range []string{pan, "987", "0123456789abcdef", "A1234"} {
+		if strings.Contains(string(data), s) {
+			t.Errorf("fixture contains %q: %s", s, data)
+		}
+	}
+	if !strings.Contains(string(data), "order_1") || !strings.Contains(string(data), "411111XXXXXX1111") {
+		t.Errorf("unexpected fixture: %s", data)
+	}
+}
+
+func TestFixtureName(t *testing.T) {
+	f := &Fixture{OperationType: "payment", OrderID: "order/1 é"}
+	if name := fixtureName(3, f); name != "0003_payment_order_1.json" {
+		t.Errorf("unexpected name: %s", name)
+	}
+	f = &Fixture{OperationType: "stopntimes"}
+	if name := fixtureName(12, f); name != "0012_stopntimes.json" {
+		t.Errorf("unexpected name: %s", name)
+	}
+}
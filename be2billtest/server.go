@@ -0,0 +1,360 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package be2billtest provides an in-memory be2bill server for testing.
+
+A Server simulates the hosted payment page, and the Direct Link, export
+and reconciliation services of the be2bill platform. It verifies the signature of every request using
+the account password, and keeps track of the transactions, aliases and
+scheduled payments it creates so that captures, refunds and StopNTimes
+calls behave as they would on the real platform.
+
+The execution code of a transaction is chosen by the card number,
+see CardNumber and the Card* constants.
+
+	srv := be2billtest.NewServer("test", "password")
+	defer srv.Close()
+
+	client := be2bill.NewDirectLinkClient(srv.Credentials())
+	result, err := client.Payment(be2billtest.CardSuccess, ...)
+
+Forms rendered by a be2bill.FormClient post to the hosted payment page of
+the server, which asks for the card holder information, then sends a signed
+notification to NotificationURL and redirects the customer to ReturnURL.
+Checkout simulates a customer going through these steps:
+
+	srv.ReturnURL = merchant.URL + "/return"
+	srv.NotificationURL = merchant.URL + "/notification"
+
+	form := be2bill.NewFormClient(srv.Credentials()).BuildPaymentFormButton(...)
+	resp, err := srv.Checkout(nil, form, card)
+
+Interactions with the real sandbox can also be recorded once using
+a Recorder, then replayed by a Replayer without any network access:
+
+	client.HTTPClient = &http.Client{Transport: be2billtest.NewRecorder("testdata", nil)}
+*/
+package be2billtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// These paths are the ones used by the be2bill clients.
+const (
+	formPath           = "/front/form/process"
+	directLinkPath     = "/front/service/rest/process"
+	exportPath         = "/front/service/rest/export"
+	reconciliationPath = "/front/service/rest/reconciliation"
+)
+
+// An operation processes the parameters of a verified request.
+type operation func(s *Server, params be2bill.Options) be2bill.Result
+
+var directLinkOperations = map[string]operation{
+	be2bill.OperationTypePayment:       (*Server).payment,
+	be2bill.OperationTypeAuthorization: (*Server).authorization,
+	be2bill.OperationTypeCredit:        (*Server).credit,
+	be2bill.OperationTypeCapture:       (*Server).capture,
+	be2bill.OperationTypeRefund:        (*Server).refund,
+	be2bill.OperationTypeStopNTimes:    (*Server).stopNTimes,
+}
+
+var exportOperations = map[string]operation{
+	be2bill.OperationTypeGetTransactions:    (*Server).export,
+	be2bill.OperationTypeExportTransactions: (*Server).export,
+	be2bill.OperationTypeExportChargebacks:  (*Server).export,
+}
+
+var reconciliationOperations = map[string]operation{
+	be2bill.OperationTypeExportReconciliation:         (*Server).export,
+	be2bill.OperationTypeExportReconciledTransactions: (*Server).export,
+}
+
+// A Transaction represents a transaction created by the server.
+type Transaction struct {
+	TransactionID string
+	OrderID       string
+	OperationType string
+	ExecCode      be2bill.ExecCode
+	// Amount is expressed in cents.
+	Amount int
+	// ParentID is the identifier of the captured or refunded transaction,
+	// for captures and refunds.
+	ParentID string
+	Alias    string
+	// CardCode is the masked card number used in the transaction.
+	CardCode string
+	// ThreeDSecure is true if the card holder had to be authenticated.
+	ThreeDSecure bool
+	// ScheduleID is the identifier of the scheduled payments created
+	// by a payment with a fragmented amount.
+	ScheduleID string
+	// Captured is true once an authorization has been captured.
+	Captured bool
+	// Refunded is the refunded amount, in cents.
+	Refunded int
+	Date     time.Time
+	// Params are the parameters of the request that created the transaction.
+	Params be2bill.Options
+}
+
+// An Installment is a payment of a schedule.
+type Installment struct {
+	// Date is formatted as YYYY-MM-DD.
+	Date string
+	// Amount is expressed in cents.
+	Amount int
+}
+
+// A Schedule represents the payments scheduled by a payment with
+// a fragmented amount.
+type Schedule struct {
+	ScheduleID    string
+	TransactionID string
+	Installments  []Installment
+	// Stopped is true once the schedule has been interrupted by StopNTimes.
+	Stopped bool
+}
+
+// A Server is a be2bill server simulator, listening on a system-chosen port
+// on the local loopback interface.
+type Server struct {
+	// URL is the base URL of the server, of the form http://ipaddr:port.
+	URL string
+	// Hasher is used to verify the signature of the requests.
+	// It is be2bill.DefaultHasher() by default.
+	Hasher be2bill.Hasher
+	// Client is used to deliver export files to callback URLs, and
+	// notifications to NotificationURL.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+	// ReturnURL is the merchant page customers are redirected to after
+	// a payment made on the hosted payment page.
+	// If empty, the result of the transaction is displayed instead.
+	ReturnURL string
+	// NotificationURL is the merchant URL the result of payments made
+	// on the hosted payment page is sent to.
+	// If empty, no notification is sent.
+	NotificationURL string
+
+	identifier string
+	password   string
+	server     *httptest.Server
+	now        func() time.Time
+
+	mu           sync.Mutex
+	lastID       int
+	transactions map[string]*Transaction
+	ids          []string
+	aliases      map[string]string
+	schedules    map[string]*Schedule
+	exports      []*Export
+	notes        []*Notification
+}
+
+// NewServer starts and returns a new Server accepting requests for
+// the account with the given identifier and password.
+// The caller should call Close when finished, to shut it down.
+func NewServer(identifier, password string) *Server {
+	s := &Server{
+		Hasher:       be2bill.DefaultHasher(),
+		identifier:   identifier,
+		password:     password,
+		now:          time.Now,
+		transactions: make(map[string]*Transaction),
+		aliases:      make(map[string]string),
+		schedules:    make(map[string]*Schedule),
+	}
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+// Notifications returns a copy of every notification sent by the server,
+// in sending order.
+func (s *Server) Notifications() []Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Notification, len(s.notes))
+	for i, n := range s.notes {
+		list[i] = *n
+	}
+	return list
+}
+
+// Close shuts down the server and blocks until all outstanding requests
+// on this server have completed.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Environment returns an environment whose only URL is the server.
+func (s *Server) Environment() be2bill.Environment {
+	return be2bill.Environment{s.URL}
+}
+
+// Credentials returns the credentials of the account served by the server,
+// using its environment.
+func (s *Server) Credentials() *be2bill.Credentials {
+	return be2bill.User(s.identifier, s.password, s.Environment())
+}
+
+// Transaction returns a copy of the transaction with the given identifier.
+func (s *Server) Transaction(id string) (Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.transactions[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	return *t, true
+}
+
+// Transactions returns a copy of every transaction created by the server,
+// in creation order.
+func (s *Server) Transactions() []Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Transaction, len(s.ids))
+	for i, id := range s.ids {
+		list[i] = *s.transactions[id]
+	}
+	return list
+}
+
+// Schedule returns a copy of the schedule with the given identifier.
+func (s *Server) Schedule(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, false
+	}
+	c := *schedule
+	c.Installments = append([]Installment(nil), schedule.Installments...)
+	return c, true
+}
+
+// Exports returns a copy of every export requested to the server,
+// in request order.
+func (s *Server) Exports() []Export {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Export, len(s.exports))
+	for i, e := range s.exports {
+		list[i] = *e
+	}
+	return list
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var operations map[string]operation
+	switch r.URL.Path {
+	case formPath:
+		s.serveForm(w, r)
+		return
+	case directLinkPath:
+		operations = directLinkOperations
+	case exportPath:
+		operations = exportOperations
+	case reconciliationPath:
+		operations = reconciliationOperations
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	form := be2bill.ParseOptions(r.PostForm)
+	method, _ := form["method"].(string)
+	params, _ := form["params"].(be2bill.Options)
+
+	result := s.process(operations, method, params)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// process verifies the request parameters, then calls the operation
+// matching the method.
+func (s *Server) process(operations map[string]operation, method string, params be2bill.Options) be2bill.Result {
+	op, ok := operations[method]
+	if !ok || params == nil {
+		return newResult(method, be2bill.ExecCodeInvalidParameter)
+	}
+	if code := s.verify(method, params); code != "" {
+		return newResult(method, code)
+	}
+	return op(s, params)
+}
+
+// verify checks the account, the signature and the version of a request
+// for the given operation, and returns the execution code of the error
+// if the request is not valid.
+func (s *Server) verify(operationType string, params be2bill.Options) be2bill.ExecCode {
+	if !hasParams(params, be2bill.ParamIdentifier, be2bill.ParamOperationType, be2bill.ParamVersion, be2bill.ParamHash) {
+		return be2bill.ExecCodeMissingParameter
+	}
+	if stringParam(params, be2bill.ParamOperationType) != operationType || stringParam(params, be2bill.ParamIdentifier) != s.identifier {
+		return be2bill.ExecCodeInvalidParameter
+	}
+	if !be2bill.CheckHash(s.Hasher, s.password, params) {
+		return be2bill.ExecCodeInvalidHash
+	}
+	if stringParam(params, be2bill.ParamVersion) != be2bill.APIVersion {
+		return be2bill.ExecCodeUnsupportedProtocol
+	}
+	return ""
+}
+
+func (s *Server) httpClient() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+func stringParam(params be2bill.Options, name string) string {
+	s, _ := params[name].(string)
+	return s
+}
+
+// hasParams returns true if every given parameter is present and not empty.
+func hasParams(params be2bill.Options, names ...string) bool {
+	for _, name := range names {
+		if stringParam(params, name) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func newResult(operationType string, code be2bill.ExecCode) be2bill.Result {
+	return be2bill.Result{
+		be2bill.ResultParamOperationType: operationType,
+		be2bill.ResultParamExecCode:      string(code),
+		be2bill.ResultParamMessage:       message(code),
+	}
+}
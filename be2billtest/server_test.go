@@ -0,0 +1,302 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2billtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+func testOrder(orderID string) be2bill.Order {
+	return be2bill.Order{
+		OrderID:         orderID,
+		ClientID:        "ident",
+		ClientEmail:     "test@test.com",
+		ClientIP:        "1.1.1.1",
+		Description:     "desc",
+		ClientUserAgent: "Firefox",
+	}
+}
+
+func testCard(pan string) be2bill.Card {
+	return be2bill.Card{
+		PAN:          pan,
+		ValidityDate: time.Now().AddDate(1, 0, 0).Format("01-06"),
+		CVV:          "123",
+		FullName:     "john doe",
+	}
+}
+
+func TestServerPayment(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	r, err := c.ProcessPayment(context.Background(), &be2bill.PaymentRequest{
+		Card:   testCard(CardSuccess),
+		Amount: be2bill.SingleAmount(1500),
+		Order:  testOrder("order_1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success() {
+		t.Fatalf("unexpected exec code: %s %s", r.ExecCode(), r.Message())
+	}
+
+	tr, ok := srv.Transaction(r.TransactionID())
+	if !ok {
+		t.Fatal("missing transaction")
+	}
+	if tr.OrderID != "order_1" || tr.Amount != 1500 || tr.CardCode != "411111XXXXXX1111" {
+		t.Errorf("unexpected transaction: %+v", tr)
+	}
+	if r.Transaction().Amount != 1500 {
+		t.Errorf("unexpected result amount: %d", r.Transaction().Amount)
+	}
+}
+
+func TestServerCardExecCodes(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	cases := []struct {
+		pan  string
+		code be2bill.ExecCode
+	}{
+		{CardSuccess, be2bill.ExecCodeSuccess},
+		{Card3DSecure, be2bill.ExecCode3DSecureRequired},
+		{CardTransactionRefused, be2bill.ExecCodeTransactionRefusedBank},
+		{CardRefused, be2bill.ExecCodeCardRefused},
+		{CardNumber(be2bill.ExecCodeTransactionTimeout), be2bill.ExecCodeTransactionTimeout},
+		{"4000000000009999", be2bill.ExecCodeSuccess},
+	}
+
+	for _, tc := range cases {
+		r, err := c.ProcessAuthorization(context.Background(), &be2bill.AuthorizationRequest{
+			Card:   testCard(tc.pan),
+			Amount: 100,
+			Order:  testOrder("order_" + tc.pan),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ExecCode() != tc.code {
+			t.Errorf("card %s: want %s, got %s", tc.pan, tc.code, r.ExecCode())
+		}
+	}
+}
+
+func TestServerInvalidHash(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewDirectLinkClient(be2bill.User("foo", "wrong", srv.Environment()))
+	c.StrictErrors = true
+	r, err := c.Capture("A000001", "order_1", "desc", nil)
+	if !errors.Is(err, be2bill.ErrInvalidHash) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if r.ExecCode() != be2bill.ExecCodeInvalidHash {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+}
+
+func TestServerCaptureRefund(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	auth, err := c.ProcessAuthorization(context.Background(), &be2bill.AuthorizationRequest{
+		Card:   testCard(CardSuccess),
+		Amount: 1000,
+		Order:  testOrder("order_1"),
+	})
+	if err != nil || !auth.Success() {
+		t.Fatalf("authorization failed: %v %v", err, auth)
+	}
+
+	// refunding an authorization is not possible
+	r, _ := c.Refund(auth.TransactionID(), "order_1", "desc", nil)
+	if r.ExecCode() != be2bill.ExecCodeTransactionNotRefundable {
+		t.Errorf("unexpected refund exec code: %s", r.ExecCode())
+	}
+
+	r, _ = c.Capture(auth.TransactionID(), "order_1", "desc", be2bill.Options{be2bill.ParamAmount: 2000})
+	if r.ExecCode() != be2bill.ExecCodeInvalidCaptureAmount {
+		t.Errorf("unexpected capture exec code: %s", r.ExecCode())
+	}
+
+	capture, _ := c.Capture(auth.TransactionID(), "order_1", "desc", be2bill.Options{be2bill.ParamAmount: 800})
+	if !capture.Success() {
+		t.Fatalf("unexpected capture exec code: %s", capture.ExecCode())
+	}
+
+	r, _ = c.Capture(auth.TransactionID(), "order_1", "desc", nil)
+	if r.ExecCode() != be2bill.ExecCodeAuthorizationNotCapturable {
+		t.Errorf("unexpected second capture exec code: %s", r.ExecCode())
+	}
+
+	r, _ = c.Refund(capture.TransactionID(), "order_1", "desc", be2bill.Options{be2bill.ParamAmount: 500})
+	if !r.Success() {
+		t.Errorf("unexpected refund exec code: %s", r.ExecCode())
+	}
+	r, _ = c.Refund(capture.TransactionID(), "order_1", "desc", be2bill.Options{be2bill.ParamAmount: 500})
+	if r.ExecCode() != be2bill.ExecCodeInvalidRefundAmount {
+		t.Errorf("unexpected refund exec code: %s", r.ExecCode())
+	}
+	r, _ = c.Refund(capture.TransactionID(), "order_1", "desc", nil)
+	if !r.Success() || r.Transaction().Amount != 300 {
+		t.Errorf("unexpected refund: %s %d", r.ExecCode(), r.Transaction().Amount)
+	}
+
+	r, _ = c.Refund("A999999", "order_1", "desc", nil)
+	if r.ExecCode() != be2bill.ExecCodeTransactionNotFound {
+		t.Errorf("unexpected refund exec code: %s", r.ExecCode())
+	}
+}
+
+func TestServerAlias(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	r, err := c.ProcessPayment(context.Background(), &be2bill.PaymentRequest{
+		Card:    testCard(CardSuccess),
+		Amount:  be2bill.SingleAmount(1500),
+		Order:   testOrder("order_1"),
+		Options: be2bill.Options{be2bill.ParamCreateAlias: "yes"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Alias() == "" {
+		t.Fatal("missing alias")
+	}
+
+	r, err = c.ProcessOneClickPayment(context.Background(), &be2bill.AliasPaymentRequest{
+		Alias:  r.Alias(),
+		Amount: be2bill.SingleAmount(500),
+		Order:  testOrder("order_2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success() {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+
+	r, _ = c.ProcessSubscriptionAuthorization(context.Background(), &be2bill.AliasAuthorizationRequest{
+		Alias:  "unknown",
+		Amount: 500,
+		Order:  testOrder("order_3"),
+	})
+	if r.ExecCode() != be2bill.ExecCodeAliasNotFound {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+}
+
+func TestServerNTimes(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	next := time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+	r, err := c.ProcessPayment(context.Background(), &be2bill.PaymentRequest{
+		Card:   testCard(CardSuccess),
+		Amount: be2bill.FragmentedAmount{"2016-01-01": 1000, next: 2000},
+		Order:  testOrder("order_1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduleID := r.StringValue(be2bill.ParamScheduleID)
+	schedule, ok := srv.Schedule(scheduleID)
+	if !ok {
+		t.Fatal("missing schedule")
+	}
+	if len(schedule.Installments) != 2 || schedule.Installments[1] != (Installment{next, 2000}) {
+		t.Errorf("unexpected installments: %v", schedule.Installments)
+	}
+
+	r, _ = c.StopNTimes(scheduleID, nil)
+	if !r.Success() {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+	r, _ = c.StopNTimes(scheduleID, nil)
+	if r.ExecCode() != be2bill.ExecCodeInterruptedSchedule {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+	r, _ = c.StopNTimes("unknown", nil)
+	if r.ExecCode() != be2bill.ExecCodeScheduleNotFound {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+}
+
+func TestServerExport(t *testing.T) {
+	srv := NewServer("foo", "bar")
+	defer srv.Close()
+
+	var records []*be2bill.TransactionRecord
+	var compression string
+	callback := httptest.NewServer(be2bill.NewExportHandler(func(r *http.Request, file *be2bill.ExportFile) error {
+		compression = file.Compression
+		reader := be2bill.NewTransactionReader(file.Body)
+		for reader.Next() {
+			records = append(records, reader.Record())
+		}
+		return reader.Err()
+	}))
+	defer callback.Close()
+
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	for _, pan := range []string{CardSuccess, CardRefused} {
+		_, err := c.ProcessPayment(context.Background(), &be2bill.PaymentRequest{
+			Card:   testCard(pan),
+			Amount: be2bill.SingleAmount(15235),
+			Order:  testOrder("order_" + pan),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := c.ExportTransactions(time.Now().UTC().Format("2006-01"), "", callback.URL, be2bill.CompressionGzip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success() {
+		t.Fatalf("unexpected exec code: %s", r.ExecCode())
+	}
+	if compression != be2bill.CompressionGzip {
+		t.Errorf("unexpected compression: %s", compression)
+	}
+	if len(records) != 2 || records[0].Amount != 15235 || records[1].ExecCode != be2bill.ExecCodeCardRefused {
+		t.Errorf("unexpected records: %v", records)
+	}
+
+	records = nil
+	r, _ = c.ExportReconciliation(time.Now().UTC().Format("2006-01-02"), callback.URL, be2bill.CompressionZip, nil)
+	if !r.Success() || len(records) != 1 {
+		t.Errorf("unexpected reconciliation: %s %v", r.ExecCode(), records)
+	}
+
+	r, _ = c.GetTransactionsByOrderID([]string{"unknown"}, "exports@example.org", be2bill.CompressionGzip)
+	if r.ExecCode() != be2bill.ExecCodeTransactionNotFound {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+
+	exports := srv.Exports()
+	if len(exports) != 3 || !exports[0].Delivered || exports[2].Delivered {
+		t.Errorf("unexpected exports: %+v", exports)
+	}
+}
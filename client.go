@@ -105,63 +105,67 @@ const (
 	ResultParamDescriptor    = "DESCRIPTOR"
 	ResultParamAmount        = "AMOUNT"
 	ResultParamRedirectHTML  = "REDIRECTHTML"
+	ResultParamOrderID       = "ORDERID"
+	ResultParamAlias         = "ALIAS"
+	ResultParamCardCode      = "CARDCODE"
+	ResultParam3DSecure      = "3DSECURE"
 )
 
 // These constants represent the possible values for the exec code result field.
 // See https://developer.be2bill.com/annexes/execcodes for more information.
 const (
-	ExecCodeSuccess                   = "0000"
-	ExecCode3DSecureRequired          = "0001"
-	ExecCodeAlternateRedirectRequired = "0002"
-
-	ExecCodeMissingParameter    = "1001"
-	ExecCodeInvalidParameter    = "1002"
-	ExecCodeInvalidHash         = "1003"
-	ExecCodeUnsupportedProtocol = "1004"
-
-	ExecCodeAliasNotFound              = "2001"
-	ExecCodeTransactionNotFound        = "2002"
-	ExecCodeUnsuccessfulTransaction    = "2003"
-	ExecCodeTransactionNotRefundable   = "2004"
-	ExecCodeAuthorizationNotCapturable = "2005"
-	ExecCodeIncompleteTransaction      = "2006"
-	ExecCodeInvalidCaptureAmount       = "2007"
-	ExecCodeInvalidRefundAmount        = "2008"
-	ExecCodeAuthorizationTimeout       = "2009"
-	ExecCodeScheduleNotFound           = "2010"
-	ExecCodeInterruptedSchedule        = "2011"
-	ExecCodeScheduleFinished           = "2012"
-
-	ExecCodeAccountDeactivated      = "3001"
-	ExecCodeUnauthorizedServerIP    = "3002"
-	ExecCodeUnauthorizedTransaction = "3003"
-
-	ExecCodeTransactionRefusedBank        = "4001"
-	ExecCodeUnsufficientFunds             = "4002"
-	ExecCodeCardRefused                   = "4003"
-	ExecCodeTransactionAbandoned          = "4004"
-	ExecCodeSuspectedFraud                = "4005"
-	ExecCodeCardLost                      = "4006"
-	ExecCodeCardStolen                    = "4007"
-	ExecCode3DSecureAuthenticationFailed  = "4008"
-	ExecCode3DSecureAuthenticationTimeout = "4009"
-	ExecCodeInvalidTransaction            = "4010"
-	ExecCodeDuplicateTransaction          = "4011"
-	ExecCodeInvalidCardData               = "4012"
-	ExecCodeTransactionNotAuthorized      = "4013"
-	ExecCodeCard3DSecureNotSupported      = "4014"
-	ExecCodeTransactionTimeout            = "4015"
-	ExecCodeTransactionRefusedByTerminal  = "4016"
-
-	ExecCodeExchangeProtocolError = "5001"
-	ExecCodeBankNetworkError      = "5002"
-	ExecCodeHandlerTimeout        = "5004"
-	ExecCode3DSecureDisplayError  = "5005"
-
-	ExecCodeTransactionRefusedMerchant      = "6001"
-	ExecCodeTransactionRefusedUnknown       = "6002"
-	ExecCodeTransactionChallenged           = "6003"
-	ExecCodeTransactionRefusedMerchantRules = "6004"
+	ExecCodeSuccess                   ExecCode = "0000"
+	ExecCode3DSecureRequired          ExecCode = "0001"
+	ExecCodeAlternateRedirectRequired ExecCode = "0002"
+
+	ExecCodeMissingParameter    ExecCode = "1001"
+	ExecCodeInvalidParameter    ExecCode = "1002"
+	ExecCodeInvalidHash         ExecCode = "1003"
+	ExecCodeUnsupportedProtocol ExecCode = "1004"
+
+	ExecCodeAliasNotFound              ExecCode = "2001"
+	ExecCodeTransactionNotFound        ExecCode = "2002"
+	ExecCodeUnsuccessfulTransaction    ExecCode = "2003"
+	ExecCodeTransactionNotRefundable   ExecCode = "2004"
+	ExecCodeAuthorizationNotCapturable ExecCode = "2005"
+	ExecCodeIncompleteTransaction      ExecCode = "2006"
+	ExecCodeInvalidCaptureAmount       ExecCode = "2007"
+	ExecCodeInvalidRefundAmount        ExecCode = "2008"
+	ExecCodeAuthorizationTimeout       ExecCode = "2009"
+	ExecCodeScheduleNotFound           ExecCode = "2010"
+	ExecCodeInterruptedSchedule        ExecCode = "2011"
+	ExecCodeScheduleFinished           ExecCode = "2012"
+
+	ExecCodeAccountDeactivated      ExecCode = "3001"
+	ExecCodeUnauthorizedServerIP    ExecCode = "3002"
+	ExecCodeUnauthorizedTransaction ExecCode = "3003"
+
+	ExecCodeTransactionRefusedBank        ExecCode = "4001"
+	ExecCodeUnsufficientFunds             ExecCode = "4002"
+	ExecCodeCardRefused                   ExecCode = "4003"
+	ExecCodeTransactionAbandoned          ExecCode = "4004"
+	ExecCodeSuspectedFraud                ExecCode = "4005"
+	ExecCodeCardLost                      ExecCode = "4006"
+	ExecCodeCardStolen                    ExecCode = "4007"
+	ExecCode3DSecureAuthenticationFailed  ExecCode = "4008"
+	ExecCode3DSecureAuthenticationTimeout ExecCode = "4009"
+	ExecCodeInvalidTransaction            ExecCode = "4010"
+	ExecCodeDuplicateTransaction          ExecCode = "4011"
+	ExecCodeInvalidCardData               ExecCode = "4012"
+	ExecCodeTransactionNotAuthorized      ExecCode = "4013"
+	ExecCodeCard3DSecureNotSupported      ExecCode = "4014"
+	ExecCodeTransactionTimeout            ExecCode = "4015"
+	ExecCodeTransactionRefusedByTerminal  ExecCode = "4016"
+
+	ExecCodeExchangeProtocolError ExecCode = "5001"
+	ExecCodeBankNetworkError      ExecCode = "5002"
+	ExecCodeHandlerTimeout        ExecCode = "5004"
+	ExecCode3DSecureDisplayError  ExecCode = "5005"
+
+	ExecCodeTransactionRefusedMerchant      ExecCode = "6001"
+	ExecCodeTransactionRefusedUnknown       ExecCode = "6002"
+	ExecCodeTransactionChallenged           ExecCode = "6003"
+	ExecCodeTransactionRefusedMerchantRules ExecCode = "6004"
 )
 
 // An Environment is the set of URLs that represent a be2bill endpoint.
@@ -170,6 +174,9 @@ const (
 // The production environment is where real transactions and sales take place.
 //
 // The sandbox can be used for testing and no real operations occur.
+//
+// Environments are copied when credentials are created, so modifying one
+// afterwards does not affect existing credentials and clients.
 type Environment []string
 
 var (
@@ -189,13 +196,33 @@ func init() {
 	}
 }
 
-// SwitchURLs reverses the order of URLs defined in the environment.
+// SwitchURLs used to reverse the order of URLs defined in the environment.
+// It now does nothing, so that the shared EnvProduction and EnvSandbox
+// environments cannot be changed while clients are created.
+//
+// Deprecated: Use Reversed, which returns a reversed copy of the environment.
+func (p Environment) SwitchURLs() {}
+
+// Reversed returns a copy of the environment with its URLs in reverse
+// order, leaving the environment itself unchanged.
 // This is useful to test the failover URLs.
-func (p Environment) SwitchURLs() {
-	for i := len(p)/2 - 1; i >= 0; i-- {
-		opp := len(p) - 1 - i
-		p[i], p[opp] = p[opp], p[i]
+func (p Environment) Reversed() Environment {
+	env := make(Environment, len(p))
+	for i, url := range p {
+		env[len(p)-1-i] = url
+	}
+	return env
+}
+
+// clone returns a copy of the environment, so that credentials and clients
+// are not affected by later changes to the original.
+func (p Environment) clone() Environment {
+	if p == nil {
+		return nil
 	}
+	env := make(Environment, len(p))
+	copy(env, p)
+	return env
 }
 
 // Credentials represent the information that is necessary for
@@ -209,19 +236,19 @@ type Credentials struct {
 // User returns new Credentials using the given client identifiers and
 // environment.
 func User(identifier string, password string, environment Environment) *Credentials {
-	return &Credentials{identifier, password, environment}
+	return &Credentials{identifier, password, environment.clone()}
 }
 
 // ProductionUser returns new Credentials using the given client identifiers
 // and the production environment.
 func ProductionUser(identifier string, password string) *Credentials {
-	return &Credentials{identifier, password, EnvProduction}
+	return &Credentials{identifier, password, EnvProduction.clone()}
 }
 
 // SandboxUser returns new Credentials using the given client identifiers
 // and the sandbox environment.
 func SandboxUser(identifier string, password string) *Credentials {
-	return &Credentials{identifier, password, EnvSandbox}
+	return &Credentials{identifier, password, EnvSandbox.clone()}
 }
 
 // BuildSandboxFormClient returns a new FormClient using the given
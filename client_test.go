@@ -75,6 +75,9 @@ func TestDirectLinkClient(t *testing.T) {
 	if client.credentials != user {
 		t.Errorf("unexpected credentials: %s", client.credentials)
 	}
+	if client.HTTPClient == nil {
+		t.Error("nil HTTP client")
+	}
 
 	client = BuildSandboxDirectLinkClient("foo", "bar")
 	if client.credentials.identifier != "foo" {
@@ -100,25 +103,28 @@ func TestDirectLinkClient(t *testing.T) {
 }
 
 func TestSwitchURLs(t *testing.T) {
+	EnvProduction.SwitchURLs()
+
+	// the shared environment is left unchanged
 	if EnvProduction[0] != "https://secure-magenta1.be2bill.com" {
 		t.Errorf("unexpected primary production URL: %s", EnvProduction[0])
 	}
 	if EnvProduction[1] != "https://secure-magenta2.be2bill.com" {
 		t.Errorf("unexpected secondary production URL: %s", EnvProduction[1])
 	}
+}
 
-	EnvProduction.SwitchURLs()
+func TestReversed(t *testing.T) {
+	env := EnvProduction.Reversed()
 
-	if EnvProduction[0] != "https://secure-magenta2.be2bill.com" {
-		t.Errorf("unexpected primary production URL: %s", EnvProduction[0])
+	if env[0] != "https://secure-magenta2.be2bill.com" {
+		t.Errorf("unexpected primary production URL: %s", env[0])
 	}
-	if EnvProduction[1] != "https://secure-magenta1.be2bill.com" {
-		t.Errorf("unexpected secondary production URL: %s", EnvProduction[1])
+	if env[1] != "https://secure-magenta1.be2bill.com" {
+		t.Errorf("unexpected secondary production URL: %s", env[1])
 	}
 
-	// restore normal order
-	EnvProduction.SwitchURLs()
-
+	// the original environment is left unchanged
 	if EnvProduction[0] != "https://secure-magenta1.be2bill.com" {
 		t.Errorf("unexpected primary production URL: %s", EnvProduction[0])
 	}
@@ -126,3 +132,14 @@ func TestSwitchURLs(t *testing.T) {
 		t.Errorf("unexpected secondary production URL: %s", EnvProduction[1])
 	}
 }
+
+func TestEnvironmentCopy(t *testing.T) {
+	env := Environment{"https://primary.example.org", "https://failover.example.org"}
+	user := User("foo", "bar", env)
+
+	env[0] = "https://other.example.org"
+
+	if user.environment[0] != "https://primary.example.org" {
+		t.Errorf("unexpected environment: %v", user.environment)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// A command executes an invocation and returns the exit status.
+type command func(p *invocation) int
+
+var commands = map[string]command{
+	"capture":               capture,
+	"refund":                refund,
+	"stop-ntimes":           stopNTimes,
+	"export-transactions":   exportTransactions,
+	"export-chargebacks":    exportChargebacks,
+	"export-reconciliation": exportReconciliation,
+	"get-transactions":      getTransactions,
+	"hash":                  hash,
+}
+
+func capture(p *invocation) int {
+	fs := p.flagSet()
+	transactionID := fs.String("transaction", "", "identifier of the authorization")
+	orderID := fs.String("order", "", "identifier of the order")
+	description := fs.String("description", "", "description of the capture")
+	amount := fs.Int("amount", 0, "captured amount in cents, for partial captures")
+	if !p.parse(fs) {
+		return exitUsage
+	}
+
+	client, err := p.client()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+
+	options := be2bill.Options{}
+	if *amount > 0 {
+		options[be2bill.ParamAmount] = *amount
+	}
+	return p.printResult(client.ProcessCapture(context.Background(), &be2bill.CaptureRequest{
+		TransactionID: *transactionID,
+		OrderID:       *orderID,
+		Description:   *description,
+		Options:       options,
+	}))
+}
+
+func refund(p *invocation) int {
+	fs := p.flagSet()
+	transactionID := fs.String("transaction", "", "identifier of the refunded transaction")
+	orderID := fs.String("order", "", "identifier of the order")
+	description := fs.String("description", "", "description of the refund")
+	amount := fs.Int("amount", 0, "refunded amount in cents, for partial refunds")
+	if !p.parse(fs) {
+		return exitUsage
+	}
+
+	client, err := p.client()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+
+	options := be2bill.Options{}
+	if *amount > 0 {
+		options[be2bill.ParamAmount] = *amount
+	}
+	return p.printResult(client.ProcessRefund(context.Background(), &be2bill.RefundRequest{
+		TransactionID: *transactionID,
+		OrderID:       *orderID,
+		Description:   *description,
+		Options:       options,
+	}))
+}
+
+func stopNTimes(p *invocation) int {
+	fs := p.flagSet()
+	scheduleID := fs.String("schedule", "", "identifier of the schedule")
+	if !p.parse(fs) {
+		return exitUsage
+	}
+	if *scheduleID == "" {
+		p.usageError("missing -schedule")
+		return exitUsage
+	}
+
+	client, err := p.client()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+	return p.printResult(client.StopNTimes(*scheduleID, nil))
+}
+
+// exportFlags holds the flags of the export commands.
+type exportFlags struct {
+	date        *string
+	startDate   *string
+	endDate     *string
+	destination *string
+	compression *string
+}
+
+func (p *invocation) exportFlags(interval bool) (*exportFlags, bool) {
+	fs := p.flagSet()
+	f := &exportFlags{
+		date:        fs.String("date", "", "exported `date`, as YYYY-MM or YYYY-MM-DD"),
+		destination: fs.String("destination", "", "HTTP URL or email address the file is sent to"),
+		compression: fs.String("compression", be2bill.CompressionGzip, "compression of the file, ZIP, GZIP or BZIP"),
+	}
+	if interval {
+		f.startDate = fs.String("start", "", "first exported `date`, as YYYY-MM or YYYY-MM-DD")
+		f.endDate = fs.String("end", "", "last exported `date`, as YYYY-MM or YYYY-MM-DD")
+	}
+	if !p.parse(fs) {
+		return nil, false
+	}
+
+	if *f.destination == "" {
+		return nil, p.usageError("missing -destination")
+	}
+	if interval && *f.date == "" && (*f.startDate == "" || *f.endDate == "") {
+		return nil, p.usageError("missing -date, or -start and -end")
+	}
+	if !interval && *f.date == "" {
+		return nil, p.usageError("missing -date")
+	}
+	*f.compression = strings.ToUpper(*f.compression)
+	return f, true
+}
+
+// interval returns the start and end dates to export.
+func (f *exportFlags) interval() (string, string) {
+	if *f.date != "" {
+		return *f.date, ""
+	}
+	return *f.startDate, *f.endDate
+}
+
+func exportTransactions(p *invocation) int {
+	f, ok := p.exportFlags(true)
+	if !ok {
+		return exitUsage
+	}
+
+	client, err := p.client()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+	start, end := f.interval()
+	return p.printResult(client.ExportTransactions(start, end, *f.destination, *f.compression, nil))
+}
+
+func exportChargebacks(p *invocation) int {
+	f, ok := p.exportFlags(true)
+	if !ok {
+		return exitUsage
+	}
+
+	client, err := p.client()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+	start, end := f.interval()
+	return p.printResult(client.ExportChargebacks(start, end, *f.destination, *f.compression, nil))
+}
+
+func exportReconciliation(p *invocation) int {
+	f, ok := p.exportFlags(false)
+	if !ok {
+		return exitUsage
+	}
+
+	client, err := p.client()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+	return p.printResult(client.ExportReconciliation(*f.date, *f.destination, *f.compression, nil))
+}
+
+func getTransactions(p *invocation) int {
+	fs := p.flagSet()
+	orderIDs := fs.String("orders", "", "comma-separated list of order identifiers")
+	transactionIDs := fs.String("transactions", "", "comma-separated list of transaction identifiers")
+	destination := fs.String("destination", "", "HTTP URL or email address the file is sent to")
+	compression := fs.String("compression", be2bill.CompressionGzip, "compression of the file, ZIP, GZIP or BZIP")
+	if !p.parse(fs) {
+		return exitUsage
+	}
+	if (*orderIDs == "") == (*transactionIDs == "") {
+		p.usageError("either -orders or -transactions is required")
+		return exitUsage
+	}
+	if *destination == "" {
+		p.usageError("missing -destination")
+		return exitUsage
+	}
+
+	client, err := p.client()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+
+	if *orderIDs != "" {
+		return p.printResult(client.GetTransactionsByOrderID(strings.Split(*orderIDs, ","), *destination, strings.ToUpper(*compression)))
+	}
+	return p.printResult(client.GetTransactionsByTransactionID(strings.Split(*transactionIDs, ","), *destination, strings.ToUpper(*compression)))
+}
+
+// hash prints the hash of the parameters given as NAME=VALUE arguments.
+// Nested parameters are given as NAME[KEY]=VALUE.
+func hash(p *invocation) int {
+	fs := p.flagSet()
+	explain := fs.Bool("explain", false, "print the hashed parameters, in order, before the hash")
+	if !p.parse(fs) {
+		return exitUsage
+	}
+
+	values := url.Values{}
+	for _, arg := range fs.Args() {
+		i := strings.IndexByte(arg, '=')
+		if i <= 0 {
+			p.usageError("invalid parameter %q, want NAME=VALUE", arg)
+			return exitUsage
+		}
+		values.Set(arg[:i], arg[i+1:])
+	}
+	params := be2bill.ParseOptions(values)
+
+	if *explain {
+		for _, param := range be2bill.ExplainHash(params) {
+			fmt.Fprintln(p.stdout, param)
+		}
+	}
+
+	secrets, err := p.secrets()
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+	password, err := secrets.Secret(context.Background(), be2bill.SecretPassword)
+	if err == be2bill.ErrSecretNotFound {
+		p.usageError("missing password, set BE2BILL_PASSWORD or use -config")
+		return exitUsage
+	}
+	if err != nil {
+		return p.printResult(nil, err)
+	}
+
+	fmt.Fprintln(p.stdout, be2bill.DefaultHasher().ComputeHash(password, params))
+	return exitSuccess
+}
@@ -0,0 +1,177 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/noirotm/go-be2bill"
+)
+
+// These values are the supported output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// secretProviders is a SecretProvider returning the secret of the first
+// of its providers that has it.
+type secretProviders []be2bill.SecretProvider
+
+func (p secretProviders) Secret(ctx context.Context, name string) (string, error) {
+	for _, provider := range p {
+		v, err := provider.Secret(ctx, name)
+		if err == be2bill.ErrSecretNotFound || err == nil && v == "" {
+			continue
+		}
+		return v, err
+	}
+	return "", be2bill.ErrSecretNotFound
+}
+
+// An invocation is the execution of a command.
+type invocation struct {
+	name   string
+	args   []string
+	stdout io.Writer
+	stderr io.Writer
+
+	sandbox    bool
+	production bool
+	configFile string
+	format     string
+	url        string
+}
+
+// flagSet returns a new flag set for the command, with the flags common
+// to every command.
+func (p *invocation) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(p.name, flag.ContinueOnError)
+	fs.SetOutput(p.stderr)
+	fs.BoolVar(&p.sandbox, "sandbox", false, "use the sandbox environment")
+	fs.BoolVar(&p.production, "production", false, "use the production environment")
+	fs.StringVar(&p.configFile, "config", "", "read the credentials from the given JSON or YAML `file`")
+	fs.StringVar(&p.format, "format", formatTable, "output `format` of the result, table or json")
+	fs.StringVar(&p.url, "url", "", "send the requests to the given base `url` instead of the environment")
+	return fs
+}
+
+// parse parses the command line and checks the common flags.
+// It returns false if the command line is invalid.
+func (p *invocation) parse(fs *flag.FlagSet) bool {
+	if err := fs.Parse(p.args); err != nil {
+		return false
+	}
+	if fs.NArg() > 0 && p.name != "hash" {
+		return p.usageError("unexpected argument %q", fs.Arg(0))
+	}
+	if p.sandbox && p.production {
+		return p.usageError("-sandbox and -production are mutually exclusive")
+	}
+	if p.format != formatTable && p.format != formatJSON {
+		return p.usageError("unknown format %q", p.format)
+	}
+	return true
+}
+
+// usageError prints the given error and returns false.
+func (p *invocation) usageError(format string, args ...interface{}) bool {
+	fmt.Fprintf(p.stderr, "be2bill %s: %s\n", p.name, fmt.Sprintf(format, args...))
+	return false
+}
+
+// secrets returns the provider of the credentials of the account, which
+// reads them from the flags, then from the environment variables, then
+// from the configuration file.
+func (p *invocation) secrets() (be2bill.SecretProvider, error) {
+	flags := be2bill.MemorySecretProvider{}
+	switch {
+	case p.url != "":
+		flags[be2bill.SecretEnvironment] = p.url
+	case p.sandbox:
+		flags[be2bill.SecretEnvironment] = be2bill.EnvironmentSandbox
+	case p.production:
+		flags[be2bill.SecretEnvironment] = be2bill.EnvironmentProduction
+	}
+
+	providers := secretProviders{flags, be2bill.EnvSecretProvider{}}
+	if p.configFile != "" {
+		file, err := be2bill.ReadCredentialsFile(p.configFile)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, file)
+	}
+	return providers, nil
+}
+
+// credentials returns the credentials of the account.
+func (p *invocation) credentials() (*be2bill.Credentials, error) {
+	secrets, err := p.secrets()
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := be2bill.LoadCredentials(context.Background(), secrets)
+	var credentialsErr *be2bill.CredentialsError
+	if errors.As(err, &credentialsErr) && errors.Is(err, be2bill.ErrSecretNotFound) {
+		if credentialsErr.Name == be2bill.SecretEnvironment {
+			return nil, errors.New("missing environment, use -sandbox or -production")
+		}
+		return nil, errors.New("missing credentials, set BE2BILL_IDENTIFIER and BE2BILL_PASSWORD or use -config")
+	}
+	return credentials, err
+}
+
+// client returns a DirectLinkClient for the account.
+func (p *invocation) client() (*be2bill.DirectLinkClient, error) {
+	credentials, err := p.credentials()
+	if err != nil {
+		return nil, err
+	}
+	return be2bill.NewDirectLinkClient(credentials), nil
+}
+
+// printResult prints the result of an operation, and returns the exit status.
+func (p *invocation) printResult(result be2bill.Result, err error) int {
+	if result != nil {
+		if p.format == formatJSON {
+			data, _ := json.MarshalIndent(result, "", "  ")
+			fmt.Fprintf(p.stdout, "%s\n", data)
+		} else {
+			keys := make([]string, 0, len(result))
+			for k := range result {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			w := tabwriter.NewWriter(p.stdout, 0, 8, 2, ' ', 0)
+			for _, k := range keys {
+				fmt.Fprintf(w, "%s\t%v\n", k, result[k])
+			}
+			_ = w.Flush()
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(p.stderr, "be2bill %s: %v\n", p.name, err)
+		var validationErr *be2bill.ValidationError
+		if errors.As(err, &validationErr) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+	if !result.Success() {
+		return exitFailure
+	}
+	return exitSuccess
+}
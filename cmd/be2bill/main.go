@@ -0,0 +1,108 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Command be2bill performs Direct Link operations on a be2bill account.
+
+Usage:
+
+	be2bill <command> [flags]
+
+The commands are:
+
+	capture                capture an authorization
+	refund                 refund a transaction
+	stop-ntimes            cancel the scheduled payments of a transaction
+	export-transactions    export the transactions of a date or interval
+	export-chargebacks     export the chargebacks of a date or interval
+	export-reconciliation  export the reconciliation of a date
+	get-transactions       export transactions by order or transaction ID
+	hash                   compute the hash of a set of parameters
+
+Every command accepts the following flags:
+
+	-sandbox      use the sandbox environment
+	-production   use the production environment
+	-config file  read the credentials from a JSON or YAML configuration file
+	-format fmt   output format of the result, table (default) or json
+	-url url      send the requests to the given base URL instead of
+	              the servers of the environment
+
+The credentials are read from the configuration file if any, as described
+in be2bill.LoadCredentialsFile, for example:
+
+	{
+		"identifier": "MY ACCOUNT",
+		"password": "secret",
+		"environment": "sandbox"
+	}
+
+then from the BE2BILL_IDENTIFIER, BE2BILL_PASSWORD and BE2BILL_ENVIRONMENT
+environment variables, which take precedence over the file.
+The environment must be given, either in the configuration or using
+the -sandbox or -production flags.
+
+The hash command takes the parameters as NAME=VALUE arguments, and
+NAME[KEY]=VALUE for nested parameters. With the -explain flag, it prints
+the hashed parameters in the order they are hashed before the hash,
+which helps diagnosing requests rejected with an invalid hash.
+
+The exit status is 0 if the operation succeeded, 1 if it failed or if
+the server returned an execution code denoting a failure, and 2 if
+the command line is invalid.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// These values are the exit statuses of the command.
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+const usage = `usage: be2bill <command> [flags]
+
+commands:
+  capture                capture an authorization
+  refund                 refund a transaction
+  stop-ntimes            cancel the scheduled payments of a transaction
+  export-transactions    export the transactions of a date or interval
+  export-chargebacks     export the chargebacks of a date or interval
+  export-reconciliation  export the reconciliation of a date
+  get-transactions       export transactions by order or transaction ID
+  hash                   compute the hash of a set of parameters
+
+Run 'be2bill <command> -h' for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line given as args, and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "be2bill: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+
+	return cmd(&invocation{
+		name:   args[0],
+		args:   args[1:],
+		stdout: stdout,
+		stderr: stderr,
+	})
+}
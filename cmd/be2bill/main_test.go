@@ -0,0 +1,188 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noirotm/go-be2bill"
+	"github.com/noirotm/go-be2bill/be2billtest"
+)
+
+// setEnv sets the environment variables read by the command for
+// the duration of the test.
+func setEnv(t *testing.T, env map[string]string) {
+	for _, name := range []string{be2bill.SecretIdentifier, be2bill.SecretPassword, be2bill.SecretEnvironment} {
+		t.Setenv(name, env[name])
+	}
+}
+
+func authorize(t *testing.T, srv *be2billtest.Server, amount int) string {
+	c := be2bill.NewDirectLinkClient(srv.Credentials())
+	r, err := c.ProcessAuthorization(context.Background(), &be2bill.AuthorizationRequest{
+		Card: be2bill.Card{
+			PAN:          be2billtest.CardSuccess,
+			ValidityDate: time.Now().AddDate(1, 0, 0).Format("01-06"),
+			CVV:          "123",
+			FullName:     "john doe",
+		},
+		Amount: amount,
+		Order: be2bill.Order{
+			OrderID:         "order_1",
+			ClientID:        "ident",
+			ClientEmail:     "test@test.com",
+			ClientIP:        "1.1.1.1",
+			Description:     "desc",
+			ClientUserAgent: "Firefox",
+		},
+	})
+	if err != nil || !r.Success() {
+		t.Fatalf("authorization failed: %v %v", err, r)
+	}
+	return r.TransactionID()
+}
+
+func TestCaptureRefund(t *testing.T) {
+	srv := be2billtest.NewServer("foo", "bar")
+	defer srv.Close()
+
+	setEnv(t, map[string]string{"BE2BILL_IDENTIFIER": "foo", "BE2BILL_PASSWORD": "bar"})
+	id := authorize(t, srv, 1000)
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"capture", "-url", srv.URL, "-format", "json",
+		"-transaction", id, "-order", "order_1", "-description", "capture"}, &stdout, &stderr)
+	if status != exitSuccess {
+		t.Fatalf("unexpected status %d: %s", status, stderr.String())
+	}
+	var result be2bill.Result
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success() || result.OperationType() != be2bill.OperationTypeCapture {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	// refunding more than the captured amount fails
+	stdout.Reset()
+	status = run([]string{"refund", "-url", srv.URL, "-transaction", result.TransactionID(),
+		"-order", "order_1", "-description", "refund", "-amount", "2000"}, &stdout, &stderr)
+	if status != exitFailure {
+		t.Errorf("unexpected status %d", status)
+	}
+	if !strings.Contains(stdout.String(), string(be2bill.ExecCodeInvalidRefundAmount)) {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	setEnv(t, map[string]string{"BE2BILL_IDENTIFIER": "foo", "BE2BILL_PASSWORD": "bar"})
+	cases := [][]string{
+		{},
+		{"unknown"},
+		{"capture", "-sandbox", "-production"},
+		{"capture", "-sandbox", "-format", "xml"},
+		{"capture", "-sandbox", "-order", "order_1", "-description", "desc"},
+		{"stop-ntimes", "-sandbox"},
+		{"export-transactions", "-sandbox", "-destination", "exports@example.org"},
+		{"get-transactions", "-sandbox", "-destination", "exports@example.org"},
+	}
+
+	for _, args := range cases {
+		var stdout, stderr bytes.Buffer
+		if status := run(args, &stdout, &stderr); status != exitUsage {
+			t.Errorf("%v: unexpected status %d", args, status)
+		}
+	}
+
+	// the environment must be explicit
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"stop-ntimes", "-schedule", "S1"}, &stdout, &stderr)
+	if status != exitFailure || !strings.Contains(stderr.String(), "environment") {
+		t.Errorf("unexpected status %d: %s", status, stderr.String())
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	srv := be2billtest.NewServer("foo", "bar")
+	defer srv.Close()
+
+	f, err := ioutil.TempFile("", "be2bill*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, _ = f.WriteString(`{"identifier": "foo", "password": "bar", "environment": "sandbox"}`)
+	_ = f.Close()
+
+	setEnv(t, nil)
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"export-transactions", "-config", f.Name(), "-url", srv.URL,
+		"-date", "2016-05", "-destination", "exports@example.org"}, &stdout, &stderr)
+	if status != exitSuccess {
+		t.Fatalf("unexpected status %d: %s", status, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "EXECCODE") || !strings.Contains(stdout.String(), "0000") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+
+	// the environment variables take precedence over the file
+	y, err := ioutil.TempFile("", "be2bill*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(y.Name()) }()
+	_, _ = y.WriteString("identifier: foo\npassword: wrong\n")
+	_ = y.Close()
+
+	setEnv(t, map[string]string{"BE2BILL_PASSWORD": "bar"})
+	stdout.Reset()
+	status = run([]string{"export-transactions", "-config", y.Name(), "-url", srv.URL, "-format", "json",
+		"-date", "2016-05", "-destination", "exports@example.org"}, &stdout, &stderr)
+	if status != exitSuccess || !strings.Contains(stdout.String(), "0000") {
+		t.Errorf("unexpected status %d: %s%s", status, stdout.String(), stderr.String())
+	}
+}
+
+func TestHash(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	setEnv(t, map[string]string{"BE2BILL_PASSWORD": "bar"})
+	status := run([]string{"hash", "IDENTIFIER=foo", "AMOUNTS[2016-05-14]=100", "AMOUNTS[2016-06-14]=200"}, &stdout, &stderr)
+	if status != exitSuccess {
+		t.Fatalf("unexpected status %d: %s", status, stderr.String())
+	}
+
+	want := be2bill.DefaultHasher().ComputeHash("bar", be2bill.Options{
+		"IDENTIFIER": "foo",
+		"AMOUNTS":    be2bill.Options{"2016-05-14": "100", "2016-06-14": "200"},
+	})
+	if got := strings.TrimSpace(stdout.String()); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestHashExplain(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	setEnv(t, map[string]string{"BE2BILL_PASSWORD": "bar"})
+	status := run([]string{"hash", "-explain", "IDENTIFIER=foo", "AMOUNTS[2016-05-14]=100"}, &stdout, &stderr)
+	if status != exitSuccess {
+		t.Fatalf("unexpected status %d: %s", status, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || lines[0] != "AMOUNTS[2016-05-14]=100" || lines[1] != "IDENTIFIER=foo" {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "bar") {
+		t.Errorf("password printed: %s", stdout.String())
+	}
+}
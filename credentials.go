@@ -0,0 +1,317 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// redacted replaces the passwords in the textual representations of
+// the credentials.
+const redacted = "REDACTED"
+
+// String returns a representation of the credentials with the password
+// redacted, so that it is safe to print and log.
+func (p Credentials) String() string {
+	return fmt.Sprintf("{%s %s %v}", p.identifier, redacted, []string(p.environment))
+}
+
+// GoString returns a representation of the credentials used by the %#v
+// format, with the password redacted.
+func (p Credentials) GoString() string {
+	return fmt.Sprintf("be2bill.Credentials{identifier:%q, password:%q, environment:%#v}",
+		p.identifier, redacted, p.environment)
+}
+
+// LogValue implements slog.LogValuer, and logs the credentials as a group
+// with the password redacted.
+func (p Credentials) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("identifier", p.identifier),
+		slog.String("password", redacted),
+		slog.Any("environment", []string(p.environment)),
+	)
+}
+
+// These values are the names of the secrets read by LoadCredentials, which
+// are also the names of the environment variables read by
+// LoadCredentialsFromEnv.
+const (
+	SecretIdentifier  = "BE2BILL_IDENTIFIER"
+	SecretPassword    = "BE2BILL_PASSWORD"
+	SecretEnvironment = "BE2BILL_ENVIRONMENT"
+)
+
+// These values are the names of the environments in the credentials
+// read by the loaders.
+const (
+	EnvironmentProduction = "production"
+	EnvironmentSandbox    = "sandbox"
+)
+
+// ErrSecretNotFound is returned by a SecretProvider when a secret
+// does not exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// A CredentialsError is returned when credentials cannot be loaded.
+type CredentialsError struct {
+	// Source is the source of the credentials, such as a file name.
+	Source string
+	// Name is the name of the invalid or missing value, if any.
+	Name string
+	Err  error
+}
+
+func (e *CredentialsError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("be2bill credentials from %s: %s: %v", e.Source, e.Name, e.Err)
+	}
+	return fmt.Sprintf("be2bill credentials from %s: %v", e.Source, e.Err)
+}
+
+func (e *CredentialsError) Unwrap() error {
+	return e.Err
+}
+
+// A SecretProvider gives access to secrets stored outside of the code,
+// such as the password of a be2bill account.
+type SecretProvider interface {
+	// Secret returns the value of the named secret, or ErrSecretNotFound
+	// if it does not exist.
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSecretProvider is a SecretProvider reading the secrets from
+// the environment variables of the same name.
+type EnvSecretProvider struct{}
+
+// Secret returns the value of the environment variable with the given name.
+// Empty variables are considered missing.
+func (EnvSecretProvider) Secret(ctx context.Context, name string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// A FileSecretProvider is a SecretProvider reading each secret from the file
+// of the same name in a directory, as mounted by container orchestrators.
+// Leading and trailing white space is removed from the values.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret returns the contents of the file with the given name.
+func (p *FileSecretProvider) Secret(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", ErrSecretNotFound
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(p.Dir, name))
+	if os.IsNotExist(err) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// A MemorySecretProvider is a SecretProvider holding its secrets in memory,
+// mainly used in tests.
+type MemorySecretProvider map[string]string
+
+// Secret returns the secret with the given name.
+func (p MemorySecretProvider) Secret(ctx context.Context, name string) (string, error) {
+	if v, ok := p[name]; ok {
+		return v, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// LoadCredentials returns the credentials read from the SecretIdentifier,
+// SecretPassword and SecretEnvironment secrets of the given provider.
+//
+// The environment is either "production", "sandbox", or a comma-separated
+// list of URLs.
+func LoadCredentials(ctx context.Context, provider SecretProvider) (*Credentials, error) {
+	return loadCredentials(ctx, "secret provider", provider)
+}
+
+// LoadCredentialsFromEnv returns the credentials read from the
+// BE2BILL_IDENTIFIER, BE2BILL_PASSWORD and BE2BILL_ENVIRONMENT
+// environment variables, as described in LoadCredentials.
+func LoadCredentialsFromEnv() (*Credentials, error) {
+	return loadCredentials(context.Background(), "environment", EnvSecretProvider{})
+}
+
+// configKeys associates the keys of the configuration files to
+// the corresponding secret names.
+var configKeys = map[string]string{
+	"identifier":  SecretIdentifier,
+	"password":    SecretPassword,
+	"environment": SecretEnvironment,
+}
+
+// LoadCredentialsFile returns the credentials read from the given JSON or
+// YAML configuration file, depending on its extension.
+//
+// The file has the identifier, password and environment keys, with
+// the same values as described in LoadCredentials:
+//
+//	{
+//		"identifier": "MY ACCOUNT",
+//		"password": "secret",
+//		"environment": "sandbox"
+//	}
+//
+// Only YAML files made of a single mapping of strings are supported:
+//
+//	identifier: MY ACCOUNT
+//	password: "secret"
+//	environment: sandbox
+func LoadCredentialsFile(name string) (*Credentials, error) {
+	secrets, err := ReadCredentialsFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return loadCredentials(context.Background(), name, secrets)
+}
+
+// ReadCredentialsFile returns the values read from the given configuration
+// file, as described in LoadCredentialsFile, keyed by their secret names.
+// It lets the values of the file be combined with other secret providers,
+// and does not check that they are complete.
+func ReadCredentialsFile(name string) (MemorySecretProvider, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, &CredentialsError{Source: name, Err: err}
+	}
+
+	var config map[string]string
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	case ".yaml", ".yml":
+		config, err = parseYAMLMapping(data)
+	default:
+		err = fmt.Errorf("unsupported file extension %q", ext)
+	}
+	if err != nil {
+		return nil, &CredentialsError{Source: name, Err: err}
+	}
+
+	secrets := MemorySecretProvider{}
+	for k, v := range config {
+		if secret, ok := configKeys[k]; ok {
+			secrets[secret] = v
+		}
+	}
+	return secrets, nil
+}
+
+func loadCredentials(ctx context.Context, source string, provider SecretProvider) (*Credentials, error) {
+	var values [3]string
+	for i, name := range []string{SecretIdentifier, SecretPassword, SecretEnvironment} {
+		v, err := provider.Secret(ctx, name)
+		if err == nil && v == "" {
+			err = ErrSecretNotFound
+		}
+		if err != nil {
+			return nil, &CredentialsError{Source: source, Name: name, Err: err}
+		}
+		values[i] = v
+	}
+
+	env, err := parseEnvironment(values[2])
+	if err != nil {
+		return nil, &CredentialsError{Source: source, Name: SecretEnvironment, Err: err}
+	}
+	return User(values[0], values[1], env), nil
+}
+
+// parseEnvironment returns the environment of the given name, or made of
+// the given comma-separated URLs.
+func parseEnvironment(s string) (Environment, error) {
+	switch strings.ToLower(s) {
+	case EnvironmentProduction:
+		return EnvProduction, nil
+	case EnvironmentSandbox:
+		return EnvSandbox, nil
+	}
+
+	var env Environment
+	for _, url := range strings.Split(s, ",") {
+		url = strings.TrimSpace(url)
+		if !isHTTPURL(url) {
+			return nil, fmt.Errorf("invalid environment %q", s)
+		}
+		env = append(env, strings.TrimSuffix(url, "/"))
+	}
+	return env, nil
+}
+
+// parseYAMLMapping parses a YAML document made of a single mapping of
+// plain or quoted strings.
+func parseYAMLMapping(data []byte) (map[string]string, error) {
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i <= 0 || line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unsupported YAML syntax", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		value, err := parseYAMLScalar(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", n, key, err)
+		}
+		result[key] = value
+	}
+	return result, scanner.Err()
+}
+
+// parseYAMLScalar returns the value of a plain, single-quoted or
+// double-quoted YAML string.
+// Its errors never include the value, which may be a password.
+func parseYAMLScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		var v string
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return "", errors.New("invalid double-quoted string")
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", errors.New("invalid single-quoted string")
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s != "" && strings.IndexByte("[{&*!|>%@`", s[0]) >= 0 {
+		return "", errors.New("unsupported YAML value")
+	}
+	return s, nil
+}
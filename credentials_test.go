@@ -0,0 +1,209 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCredentialsRedaction(t *testing.T) {
+	c := SandboxUser("foo", "s3cr3t")
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		for _, v := range []interface{}{c, *c} {
+			s := fmt.Sprintf(format, v)
+			if strings.Contains(s, "s3cr3t") || !strings.Contains(s, "foo") {
+				t.Errorf("%s: password not redacted: %s", format, s)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("client", "credentials", c)
+	if strings.Contains(buf.String(), "s3cr3t") || !strings.Contains(buf.String(), `"identifier":"foo"`) {
+		t.Errorf("password not redacted: %s", buf.String())
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	c, err := LoadCredentials(context.Background(), MemorySecretProvider{
+		SecretIdentifier:  "foo",
+		SecretPassword:    "bar",
+		SecretEnvironment: "sandbox",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, SandboxUser("foo", "bar")) {
+		t.Errorf("unexpected credentials: %v", c)
+	}
+
+	c, err = LoadCredentials(context.Background(), MemorySecretProvider{
+		SecretIdentifier:  "foo",
+		SecretPassword:    "bar",
+		SecretEnvironment: "https://a.example.org/, https://b.example.org",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.environment, Environment{"https://a.example.org", "https://b.example.org"}) {
+		t.Errorf("unexpected environment: %v", c.environment)
+	}
+
+	testCases := []struct {
+		secrets MemorySecretProvider
+		name    string
+		err     error
+	}{
+		{MemorySecretProvider{SecretIdentifier: "foo", SecretEnvironment: "sandbox"}, SecretPassword, ErrSecretNotFound},
+		{MemorySecretProvider{SecretIdentifier: "foo", SecretPassword: "", SecretEnvironment: "sandbox"}, SecretPassword, ErrSecretNotFound},
+		{MemorySecretProvider{SecretIdentifier: "foo", SecretPassword: "bar", SecretEnvironment: "staging"}, SecretEnvironment, nil},
+	}
+	for _, tc := range testCases {
+		_, err := LoadCredentials(context.Background(), tc.secrets)
+		e, ok := err.(*CredentialsError)
+		if !ok || e.Name != tc.name || (tc.err != nil && !errors.Is(err, tc.err)) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestLoadCredentialsFromEnv(t *testing.T) {
+	t.Setenv(SecretIdentifier, "foo")
+	t.Setenv(SecretPassword, "bar")
+	t.Setenv(SecretEnvironment, "production")
+
+	c, err := LoadCredentialsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, ProductionUser("foo", "bar")) {
+		t.Errorf("unexpected credentials: %v", c)
+	}
+
+	t.Setenv(SecretPassword, "")
+	if _, err := LoadCredentialsFromEnv(); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadCredentialsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "be2bill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	files := map[string]string{
+		"be2bill.json": `{"identifier": "foo", "password": "bar", "environment": "sandbox"}`,
+		"be2bill.yaml": "---\n# be2bill account\nidentifier: foo\npassword: \"bar\"\nenvironment: sandbox # test\n",
+		"be2bill.yml":  "identifier: 'foo'\npassword: bar\nenvironment: Sandbox\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, name)
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := LoadCredentialsFile(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, SandboxUser("foo", "bar")) {
+			t.Errorf("%s: unexpected credentials: %v", name, c)
+		}
+	}
+
+	invalid := map[string]string{
+		"nested.yaml":     "account:\n  identifier: foo\n",
+		"list.yaml":       "identifier: [foo]\n",
+		"missing.json":    `{"identifier": "foo", "environment": "sandbox"}`,
+		"be2bill.toml":    `identifier = "foo"`,
+		"malformed.json":  `{"identifier": `,
+		"unquoted.yaml":   "identifier: \"foo\n",
+		"nonexistent.yml": "",
+	}
+	for name, data := range invalid {
+		name = filepath.Join(dir, name)
+		if data != "" {
+			if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := LoadCredentialsFile(name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if _, ok := err.(*CredentialsError); !ok {
+			t.Errorf("%s: unexpected error type: %v", name, err)
+		}
+	}
+}
+
+func TestLoadCredentialsFileErrorRedacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "be2bill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for i, password := range []string{`"s3cr3t`, `'s3cr3t`, `[s3cr3t]`} {
+		name := filepath.Join(dir, fmt.Sprintf("be2bill%d.yaml", i))
+		data := "identifier: foo\npassword: " + password + "\nenvironment: sandbox\n"
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := LoadCredentialsFile(name)
+		if _, ok := err.(*CredentialsError); !ok {
+			t.Fatalf("%s: unexpected error: %v", password, err)
+		}
+		if msg := err.Error(); strings.Contains(msg, "s3cr3t") ||
+			!strings.Contains(msg, "line 2") || !strings.Contains(msg, "password") {
+			t.Errorf("%s: unexpected error: %s", password, msg)
+		}
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "be2bill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for name, value := range map[string]string{
+		SecretIdentifier:  "foo\n",
+		SecretPassword:    "bar\n",
+		SecretEnvironment: "sandbox",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &FileSecretProvider{Dir: dir}
+	c, err := LoadCredentials(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, SandboxUser("foo", "bar")) {
+		t.Errorf("unexpected credentials: %v", c)
+	}
+
+	for _, name := range []string{"missing", "../" + filepath.Base(dir) + "/" + SecretPassword, ""} {
+		if _, err := p.Secret(context.Background(), name); err != ErrSecretNotFound {
+			t.Errorf("%q: unexpected error: %v", name, err)
+		}
+	}
+}
@@ -5,8 +5,10 @@
 package be2bill
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -38,11 +40,13 @@ type Result map[string]interface{}
 // StringValue returns the value for the given property of a Result object.
 // The value must be of string type, otherwise an empty string is returned instead.
 func (r Result) StringValue(name string) string {
-	val, ok := r[name]
-	if !ok {
-		return ""
+	switch val := r[name].(type) {
+	case string:
+		return val
+	case ExecCode:
+		return string(val)
 	}
-	return val.(string)
+	return ""
 }
 
 // OperationType returns the name of the operation that returned this object.
@@ -55,8 +59,8 @@ func (r Result) OperationType() string {
 //
 // See https://developer.be2bill.com/annexes/execcodes for a list of supported
 // execution codes.
-func (r Result) ExecCode() string {
-	return r.StringValue(ResultParamExecCode)
+func (r Result) ExecCode() ExecCode {
+	return ExecCode(r.StringValue(ResultParamExecCode))
 }
 
 // Message returns the textual message associated with the result's execution
@@ -71,6 +75,18 @@ func (r Result) TransactionID() string {
 	return r.StringValue(ResultParamTransactionID)
 }
 
+// OrderID returns the order identifier given by the merchant for
+// the transaction associated with the current operation.
+func (r Result) OrderID() string {
+	return r.StringValue(ResultParamOrderID)
+}
+
+// Alias returns the alias created for the card used in the transaction,
+// if any.
+func (r Result) Alias() string {
+	return r.StringValue(ResultParamAlias)
+}
+
 // Success returns true if the operation succeeded, false otherwise.
 func (r Result) Success() bool {
 	return r.ExecCode() == ExecCodeSuccess
@@ -107,119 +123,239 @@ type DirectLinkClient struct {
 	hasher      Hasher
 	// RequestTimeout is the duration after which requests time out
 	// and return an ErrTimeout error.
-	// The default timeout is 30 seconds.
+	// The default timeout is 30 seconds, and a zero value disables it,
+	// leaving the deadline to the context given to the operation.
 	RequestTimeout time.Duration
+	// HTTPClient is the client used to send requests to the be2bill servers.
+	// It is shared by all the operations and all the URLs of the
+	// environment, so connections can be reused between calls.
+	// Set it to use a custom http.RoundTripper, for example to go through
+	// a proxy or to present a client certificate.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// StrictErrors enables detailed errors.
+	// When true, operations return an *ExecError along with the result
+	// if the execution code denotes a failure, and an *HTTPError instead
+	// of ErrServerError if a server answers with an unexpected status.
+	// The default is false.
+	StrictErrors bool
+	// RetryPolicy, if not nil, defines how operations that fail because of
+	// a transient error are retried.
+	// By default, operations are attempted only once.
+	RetryPolicy *RetryPolicy
+	// Selector, if not nil, chooses the order in which the URLs of
+	// the environment are tried, and is informed of the outcome of
+	// every request so it can avoid failing servers.
+	// By default, the URLs are tried in the order of the environment.
+	Selector EndpointSelector
+	// Signer, if not nil, signs the requests instead of the password
+	// of the credentials, for example during a password rotation.
+	Signer *Signer
+	// Interceptors are called in order for every request sent to a server,
+	// including retries and failover requests, the first one being
+	// the outermost.
+	Interceptors []Interceptor
+	// Logger, if not nil, logs every request sent to a server, every
+	// failover to the next URL and the outcome of every operation, with
+	// the card data masked.
+	Logger *slog.Logger
+	// LogLevels, if not nil, defines the levels of the logged messages.
+	// By default, DefaultLogLevels are used.
+	LogLevels *LogLevels
+	// Metrics, if not nil, records the number, latency and outcome of
+	// every request sent to a server, and the failovers.
+	Metrics Metrics
 }
 
 // NewDirectLinkClient returns a new DirectLinkClient using the given
 // credentials.
 func NewDirectLinkClient(credentials *Credentials) *DirectLinkClient {
 	return &DirectLinkClient{
-		credentials,
-		credentials.environment,
-		&defaultHasher{},
-		defaultRequestTimeout,
+		credentials:    credentials,
+		urls:           credentials.environment.clone(),
+		hasher:         &defaultHasher{},
+		RequestTimeout: defaultRequestTimeout,
+		HTTPClient:     &http.Client{},
+	}
+}
+
+func (p *DirectLinkClient) signer() *Signer {
+	if p.Signer != nil {
+		return p.Signer
+	}
+	return newPasswordSigner(p.hasher, p.credentials.password)
+}
+
+func (p *DirectLinkClient) log() clientLogger {
+	return newClientLogger(p.Logger, p.LogLevels)
+}
+
+func (p *DirectLinkClient) httpClient() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
 	}
+	return http.DefaultClient
 }
 
-func (p *DirectLinkClient) getURLs(path string) []string {
-	urls := make([]string, len(p.urls))
-	for i, url := range p.urls {
-		urls[i] = url + path
+// endpoints returns the base URLs to try for the next request, in order.
+func (p *DirectLinkClient) endpoints() []string {
+	if p.Selector != nil {
+		return p.Selector.Endpoints()
 	}
-	return urls
+	return p.urls
 }
 
-func (p *DirectLinkClient) getDirectLinkURLs() []string {
-	return p.getURLs(directLinkPath)
+// report records the outcome of a request sent to the given base URL.
+func (p *DirectLinkClient) report(url string, err error, latency time.Duration) {
+	if p.Selector != nil {
+		p.Selector.Report(url, err, latency)
+	}
 }
 
-func (p *DirectLinkClient) doPostRequest(url string, params Options) (Result, error) {
+func (p *DirectLinkClient) doPostRequest(ctx context.Context, call *Call) (result Result, err error) {
+	status := 0
+	start := time.Now()
+	defer func() {
+		latency := time.Since(start)
+		p.logRequest(ctx, call, status, result, err, latency)
+		p.observeRequest(call, result, err, latency)
+	}()
+
 	requestParams := Options{
-		"method": params[ParamOperationType],
-		"params": params,
+		"method": call.Params[ParamOperationType],
+		"params": call.Params,
 	}
 
-	responseChan := make(chan Result, 1)
-	errChan := make(chan error, 1)
+	reqCtx := ctx
+	if p.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, p.RequestTimeout)
+		defer cancel()
+	}
 
-	go func() {
-		client := &http.Client{
-			Timeout: p.RequestTimeout + 5*time.Second,
-		}
+	req, err := http.NewRequest("POST", call.URL, strings.NewReader(requestParams.urlValues().Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(reqCtx)
+	for k, v := range call.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-		resp, err := client.PostForm(url, requestParams.urlValues())
-		if err != nil {
-			errChan <- err
-			return
-		}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, contextError(ctx, reqCtx, err)
+	}
 
-		if resp.StatusCode != 200 {
-			errChan <- ErrServerError
-			return
+	defer func() { _ = resp.Body.Close() }()
+
+	status = resp.StatusCode
+	if resp.StatusCode != 200 {
+		if p.StrictErrors {
+			return nil, newHTTPError(resp)
 		}
+		return nil, ErrServerError
+	}
 
-		defer func() { _ = resp.Body.Close() }()
+	r := json.NewDecoder(resp.Body)
+	result = make(Result)
+	err = r.Decode(&result)
+	if err != nil {
+		return nil, contextError(ctx, reqCtx, err)
+	}
 
-		r := json.NewDecoder(resp.Body)
-		result := make(Result)
-		err = r.Decode(&result)
-		if err != nil {
-			errChan <- err
-			return
-		}
+	return result, nil
+}
 
-		responseChan <- result
-	}()
+// contextError returns the error of the parent context if it is done,
+// ErrTimeout if the request context reached its deadline, or err otherwise.
+func contextError(parent, ctx context.Context, err error) error {
+	if parentErr := parent.Err(); parentErr != nil {
+		return parentErr
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
 
-	select {
-	case err := <-errChan:
-		return nil, err
-	case <-time.After(p.RequestTimeout):
-		return nil, ErrTimeout
-	case result := <-responseChan:
-		return result, nil
+func (p *DirectLinkClient) requests(ctx context.Context, path string, params Options) (Result, error) {
+	start := time.Now()
+	if p.RetryPolicy == nil {
+		result, err := p.failover(ctx, path, params)
+		p.logOperation(ctx, params, 1, result, err, time.Since(start))
+		return result, err
 	}
+
+	attempts := 0
+	result, err := p.RetryPolicy.do(ctx, params, func() (Result, error) {
+		attempts++
+		return p.failover(ctx, path, params)
+	})
+	p.logOperation(ctx, params, attempts, result, err, time.Since(start))
+	return result, err
 }
 
-func (p *DirectLinkClient) requests(urls []string, params Options) (Result, error) {
+// failover sends the request to each endpoint in turn until one of them answers.
+func (p *DirectLinkClient) failover(ctx context.Context, path string, params Options) (Result, error) {
+	urls := p.endpoints()
 	if len(urls) == 0 {
 		return nil, ErrURLMissing
 	}
 
 	var errRet error
-	for _, url := range urls {
-		result, err := p.doPostRequest(url, params)
+	for i, url := range urls {
+		// stop trying as soon as the caller gives up
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		result, err := p.invoke(ctx, url+path, params)
+		p.report(url, err, time.Since(start))
 		if err != nil {
-			// break if a timeout occurred, otherwise try next URL
-			if err == ErrTimeout {
+			// break if a timeout occurred or if the context is done,
+			// otherwise try next URL
+			if err == ErrTimeout || ctx.Err() != nil {
 				return nil, err
 			}
-			errRet = err
+			// keep an error showing that a server may have received
+			// the request, so it is not mistaken for an unsent one
+			if errRet == nil || isNotSent(errRet) {
+				errRet = err
+			}
+			if i+1 < len(urls) {
+				p.logFailover(ctx, params, url+path, urls[i+1]+path, err)
+				p.observeFailover(params, url+path)
+			}
 			continue
 		}
 
-		return result, err
+		if p.StrictErrors && isFailure(result) {
+			return result, newExecError(result)
+		}
+		return result, nil
 	}
 
 	return nil, errRet
 }
 
-func (p *DirectLinkClient) transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent string, options Options) (Result, error) {
+func (p *DirectLinkClient) transaction(ctx context.Context, order *Order, options Options) (Result, error) {
 	params := options.copy()
 
-	params[ParamOrderID] = orderID
-	params[ParamClientIdent] = clientID
-	params[ParamClientEmail] = clientEmail
-	params[ParamDescription] = description
-	params[ParamClientUserAgent] = clientUserAgent
-	params[ParamClientIP] = clientIP
+	params[ParamOrderID] = order.OrderID
+	params[ParamClientIdent] = order.ClientID
+	params[ParamClientEmail] = order.ClientEmail
+	params[ParamDescription] = order.Description
+	params[ParamClientUserAgent] = order.ClientUserAgent
+	params[ParamClientIP] = order.ClientIP
 	params[ParamIdentifier] = p.credentials.identifier
 	params[ParamVersion] = APIVersion
 
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	params[ParamHash] = p.signer().Sign(params)
 
-	return p.requests(p.getDirectLinkURLs(), params)
+	return p.requests(ctx, directLinkPath, params)
 }
 
 func isHTTPURL(str string) bool {
@@ -227,7 +363,7 @@ func isHTTPURL(str string) bool {
 	return err == nil && (url.Scheme == "http" || url.Scheme == "https")
 }
 
-func (p *DirectLinkClient) getTransactions(searchBy string, idList []string, destination, compression string) (Result, error) {
+func (p *DirectLinkClient) getTransactions(ctx context.Context, searchBy string, idList []string, destination, compression string) (Result, error) {
 	params := Options{}
 	params[ParamOperationType] = OperationTypeGetTransactions
 	params[ParamIdentifier] = p.credentials.identifier
@@ -248,9 +384,9 @@ func (p *DirectLinkClient) getTransactions(searchBy string, idList []string, des
 		params[ParamMailTo] = destination
 	}
 
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	params[ParamHash] = p.signer().Sign(params)
 
-	return p.requests(p.getURLs(exportPath), params)
+	return p.requests(ctx, exportPath, params)
 }
 
 // Payment performs a payment operation using the given card holder information.
@@ -263,22 +399,42 @@ func (p *DirectLinkClient) Payment(
 	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	// Handle N-Time payments
-	if amount.Immediate() {
-		params[ParamAmount] = amount
-	} else {
-		params[ParamAmounts] = amount.Options()
-	}
-
-	params[ParamOperationType] = OperationTypePayment
-	params[ParamCardCode] = cardPan
-	params[ParamCardValidityDate] = cardDate
-	params[ParamCardCVV] = cardCryptogram
-	params[ParamCardFullName] = cardFullName
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.PaymentContext(
+		context.Background(),
+		cardPan, cardDate, cardCryptogram, cardFullName,
+		amount,
+		orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// PaymentContext is like Payment but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) PaymentContext(
+	ctx context.Context,
+	cardPan, cardDate, cardCryptogram, cardFullName string,
+	amount Amount,
+	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.payment(ctx, &PaymentRequest{
+		Card: Card{
+			PAN:          cardPan,
+			ValidityDate: cardDate,
+			CVV:          cardCryptogram,
+			FullName:     cardFullName,
+		},
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	})
 }
 
 // Authorization performs an authorization operation using the given card holder information.
@@ -290,16 +446,42 @@ func (p *DirectLinkClient) Authorization(
 	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	params[ParamOperationType] = OperationTypeAuthorization
-	params[ParamCardCode] = cardPan
-	params[ParamCardValidityDate] = cardDate
-	params[ParamCardCVV] = cardCryptogram
-	params[ParamCardFullName] = cardFullName
-	params[ParamAmount] = amount
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.AuthorizationContext(
+		context.Background(),
+		cardPan, cardDate, cardCryptogram, cardFullName,
+		amount,
+		orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// AuthorizationContext is like Authorization but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) AuthorizationContext(
+	ctx context.Context,
+	cardPan, cardDate, cardCryptogram, cardFullName string,
+	amount int,
+	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.authorization(ctx, &AuthorizationRequest{
+		Card: Card{
+			PAN:          cardPan,
+			ValidityDate: cardDate,
+			CVV:          cardCryptogram,
+			FullName:     cardFullName,
+		},
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	})
 }
 
 // Credit performs a credit operation using the given card holder information.
@@ -309,16 +491,42 @@ func (p *DirectLinkClient) Credit(
 	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	params[ParamOperationType] = OperationTypeCredit
-	params[ParamCardCode] = cardPan
-	params[ParamCardValidityDate] = cardDate
-	params[ParamCardCVV] = cardCryptogram
-	params[ParamCardFullName] = cardFullName
-	params[ParamAmount] = amount
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.CreditContext(
+		context.Background(),
+		cardPan, cardDate, cardCryptogram, cardFullName,
+		amount,
+		orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// CreditContext is like Credit but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) CreditContext(
+	ctx context.Context,
+	cardPan, cardDate, cardCryptogram, cardFullName string,
+	amount int,
+	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.credit(ctx, &CreditRequest{
+		Card: Card{
+			PAN:          cardPan,
+			ValidityDate: cardDate,
+			CVV:          cardCryptogram,
+			FullName:     cardFullName,
+		},
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	})
 }
 
 // OneClickPayment performs a payment operation for an already registered client.
@@ -332,20 +540,35 @@ func (p *DirectLinkClient) OneClickPayment(
 	amount Amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	// Handle N-Time payments
-	if amount.Immediate() {
-		params[ParamAmount] = amount
-	} else {
-		params[ParamAmounts] = amount.Options()
-	}
-
-	params[ParamOperationType] = OperationTypePayment
-	params[ParamAlias] = alias
-	params[ParamAliasMode] = aliasModeOneClick
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.OneClickPaymentContext(
+		context.Background(),
+		alias,
+		amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// OneClickPaymentContext is like OneClickPayment but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) OneClickPaymentContext(
+	ctx context.Context,
+	alias string,
+	amount Amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.aliasPayment(ctx, &AliasPaymentRequest{
+		Alias:  alias,
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	}, aliasModeOneClick)
 }
 
 // Refund performs a refund operation over a given previous transaction.
@@ -354,18 +577,18 @@ func (p *DirectLinkClient) OneClickPayment(
 //
 // See https://developer.be2bill.com/functions/refund
 func (p *DirectLinkClient) Refund(transactionID, orderID, description string, options Options) (Result, error) {
-	params := options.copy()
-
-	params[ParamIdentifier] = p.credentials.identifier
-	params[ParamOperationType] = OperationTypeRefund
-	params[ParamDescription] = description
-	params[ParamTransactionID] = transactionID
-	params[ParamVersion] = APIVersion
-	params[ParamOrderID] = orderID
-
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	return p.RefundContext(context.Background(), transactionID, orderID, description, options)
+}
 
-	return p.requests(p.getDirectLinkURLs(), params)
+// RefundContext is like Refund but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) RefundContext(ctx context.Context, transactionID, orderID, description string, options Options) (Result, error) {
+	return p.refund(ctx, &RefundRequest{
+		TransactionID: transactionID,
+		OrderID:       orderID,
+		Description:   description,
+		Options:       options,
+	})
 }
 
 // Capture performs a capture operation on a previous authorization.
@@ -378,18 +601,18 @@ func (p *DirectLinkClient) Refund(transactionID, orderID, description string, op
 //
 // See https://developer.be2bill.com/functions/capture
 func (p *DirectLinkClient) Capture(transactionID, orderID, description string, options Options) (Result, error) {
-	params := options.copy()
-
-	params[ParamIdentifier] = p.credentials.identifier
-	params[ParamOperationType] = OperationTypeCapture
-	params[ParamVersion] = APIVersion
-	params[ParamDescription] = description
-	params[ParamTransactionID] = transactionID
-	params[ParamOrderID] = orderID
-
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	return p.CaptureContext(context.Background(), transactionID, orderID, description, options)
+}
 
-	return p.requests(p.getDirectLinkURLs(), params)
+// CaptureContext is like Capture but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) CaptureContext(ctx context.Context, transactionID, orderID, description string, options Options) (Result, error) {
+	return p.capture(ctx, &CaptureRequest{
+		TransactionID: transactionID,
+		OrderID:       orderID,
+		Description:   description,
+		Options:       options,
+	})
 }
 
 // OneClickAuthorization performs an authorization operation for an already registered client.
@@ -403,14 +626,35 @@ func (p *DirectLinkClient) OneClickAuthorization(
 	amount int, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	params[ParamOperationType] = OperationTypeAuthorization
-	params[ParamAlias] = alias
-	params[ParamAliasMode] = aliasModeOneClick
-	params[ParamAmount] = amount
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.OneClickAuthorizationContext(
+		context.Background(),
+		alias,
+		amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// OneClickAuthorizationContext is like OneClickAuthorization but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) OneClickAuthorizationContext(
+	ctx context.Context,
+	alias string,
+	amount int, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.aliasAuthorization(ctx, &AliasAuthorizationRequest{
+		Alias:  alias,
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	}, aliasModeOneClick)
 }
 
 // SubscriptionAuthorization performs an authorization operation for an already registered client.
@@ -425,14 +669,35 @@ func (p *DirectLinkClient) SubscriptionAuthorization(
 	amount int, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	params[ParamOperationType] = OperationTypeAuthorization
-	params[ParamAlias] = alias
-	params[ParamAliasMode] = aliasModeSubscription
-	params[ParamAmount] = amount
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.SubscriptionAuthorizationContext(
+		context.Background(),
+		alias,
+		amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// SubscriptionAuthorizationContext is like SubscriptionAuthorization but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) SubscriptionAuthorizationContext(
+	ctx context.Context,
+	alias string,
+	amount int, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.aliasAuthorization(ctx, &AliasAuthorizationRequest{
+		Alias:  alias,
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	}, aliasModeSubscription)
 }
 
 // SubscriptionPayment performs a payment operation for an already registered client.
@@ -447,20 +712,35 @@ func (p *DirectLinkClient) SubscriptionPayment(
 	amount Amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	// Handle N-Time payments
-	if amount.Immediate() {
-		params[ParamAmount] = amount
-	} else {
-		params[ParamAmounts] = amount.Options()
-	}
-
-	params[ParamOperationType] = OperationTypePayment
-	params[ParamAlias] = alias
-	params[ParamAliasMode] = aliasModeSubscription
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.SubscriptionPaymentContext(
+		context.Background(),
+		alias,
+		amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// SubscriptionPaymentContext is like SubscriptionPayment but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) SubscriptionPaymentContext(
+	ctx context.Context,
+	alias string,
+	amount Amount, orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.aliasPayment(ctx, &AliasPaymentRequest{
+		Alias:  alias,
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	}, aliasModeSubscription)
 }
 
 // StopNTimes cancels future scheduled payments when a transaction has been made
@@ -469,6 +749,12 @@ func (p *DirectLinkClient) SubscriptionPayment(
 //
 // See https://developer.be2bill.com/functions/stopNTimes
 func (p *DirectLinkClient) StopNTimes(scheduleID string, options Options) (Result, error) {
+	return p.StopNTimesContext(context.Background(), scheduleID, options)
+}
+
+// StopNTimesContext is like StopNTimes but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) StopNTimesContext(ctx context.Context, scheduleID string, options Options) (Result, error) {
 	params := options.copy()
 
 	params[ParamIdentifier] = p.credentials.identifier
@@ -476,9 +762,9 @@ func (p *DirectLinkClient) StopNTimes(scheduleID string, options Options) (Resul
 	params[ParamScheduleID] = scheduleID
 	params[ParamVersion] = APIVersion
 
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	params[ParamHash] = p.signer().Sign(params)
 
-	return p.requests(p.getDirectLinkURLs(), params)
+	return p.requests(ctx, directLinkPath, params)
 }
 
 // RedirectForPayment returns HTML code used to  to redirect the customer to
@@ -507,12 +793,34 @@ func (p *DirectLinkClient) RedirectForPayment(
 	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
 	options Options,
 ) (Result, error) {
-	params := options.copy()
-
-	params[ParamOperationType] = OperationTypePayment
-	params[ParamAmount] = amount
-
-	return p.transaction(orderID, clientID, clientEmail, clientIP, description, clientUserAgent, params)
+	return p.RedirectForPaymentContext(
+		context.Background(),
+		amount,
+		orderID, clientID, clientEmail, clientIP, description, clientUserAgent,
+		options,
+	)
+}
+
+// RedirectForPaymentContext is like RedirectForPayment but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) RedirectForPaymentContext(
+	ctx context.Context,
+	amount int,
+	orderID, clientID, clientEmail, clientIP, description, clientUserAgent string,
+	options Options,
+) (Result, error) {
+	return p.redirectForPayment(ctx, &RedirectForPaymentRequest{
+		Amount: amount,
+		Order: Order{
+			OrderID:         orderID,
+			ClientID:        clientID,
+			ClientEmail:     clientEmail,
+			ClientIP:        clientIP,
+			Description:     description,
+			ClientUserAgent: clientUserAgent,
+		},
+		Options: options,
+	})
 }
 
 // GetTransactionsByTransactionID retrieves a list of transactions given a list
@@ -523,7 +831,13 @@ func (p *DirectLinkClient) RedirectForPayment(
 //
 // See https://developer.be2bill.com/functions/getTransactionsByTransactionId
 func (p *DirectLinkClient) GetTransactionsByTransactionID(transactionIDs []string, destination, compression string) (Result, error) {
-	return p.getTransactions(searchByTransactionID, transactionIDs, destination, compression)
+	return p.GetTransactionsByTransactionIDContext(context.Background(), transactionIDs, destination, compression)
+}
+
+// GetTransactionsByTransactionIDContext is like GetTransactionsByTransactionID but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) GetTransactionsByTransactionIDContext(ctx context.Context, transactionIDs []string, destination, compression string) (Result, error) {
+	return p.getTransactions(ctx, searchByTransactionID, transactionIDs, destination, compression)
 }
 
 // GetTransactionsByOrderID retrieves a list of transactions given a list
@@ -534,7 +848,13 @@ func (p *DirectLinkClient) GetTransactionsByTransactionID(transactionIDs []strin
 //
 // See https://developer.be2bill.com/functions/getTransactionsByOrderId
 func (p *DirectLinkClient) GetTransactionsByOrderID(orderIDs []string, destination, compression string) (Result, error) {
-	return p.getTransactions(searchByOrderID, orderIDs, destination, compression)
+	return p.GetTransactionsByOrderIDContext(context.Background(), orderIDs, destination, compression)
+}
+
+// GetTransactionsByOrderIDContext is like GetTransactionsByOrderID but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) GetTransactionsByOrderIDContext(ctx context.Context, orderIDs []string, destination, compression string) (Result, error) {
+	return p.getTransactions(ctx, searchByOrderID, orderIDs, destination, compression)
 }
 
 // ExportTransactions retrieves a list of transactions given a date or
@@ -549,6 +869,12 @@ func (p *DirectLinkClient) GetTransactionsByOrderID(orderIDs []string, destinati
 //
 // See https://developer.be2bill.com/functions/exportTransactions
 func (p *DirectLinkClient) ExportTransactions(startDate, endDate, destination, compression string, options Options) (Result, error) {
+	return p.ExportTransactionsContext(context.Background(), startDate, endDate, destination, compression, options)
+}
+
+// ExportTransactionsContext is like ExportTransactions but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) ExportTransactionsContext(ctx context.Context, startDate, endDate, destination, compression string, options Options) (Result, error) {
 	params := options.copy()
 
 	params[ParamOperationType] = OperationTypeExportTransactions
@@ -570,9 +896,9 @@ func (p *DirectLinkClient) ExportTransactions(startDate, endDate, destination, c
 		params[ParamMailTo] = destination
 	}
 
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	params[ParamHash] = p.signer().Sign(params)
 
-	return p.requests(p.getURLs(exportPath), params)
+	return p.requests(ctx, exportPath, params)
 }
 
 // ExportChargebacks retrieves a list of chargebacks given a date or
@@ -587,6 +913,12 @@ func (p *DirectLinkClient) ExportTransactions(startDate, endDate, destination, c
 //
 // See https://developer.be2bill.com/functions/exportChargebacks
 func (p *DirectLinkClient) ExportChargebacks(startDate, endDate, destination, compression string, options Options) (Result, error) {
+	return p.ExportChargebacksContext(context.Background(), startDate, endDate, destination, compression, options)
+}
+
+// ExportChargebacksContext is like ExportChargebacks but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) ExportChargebacksContext(ctx context.Context, startDate, endDate, destination, compression string, options Options) (Result, error) {
 	params := options.copy()
 
 	params[ParamOperationType] = OperationTypeExportChargebacks
@@ -608,9 +940,9 @@ func (p *DirectLinkClient) ExportChargebacks(startDate, endDate, destination, co
 		params[ParamMailTo] = destination
 	}
 
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	params[ParamHash] = p.signer().Sign(params)
 
-	return p.requests(p.getURLs(exportPath), params)
+	return p.requests(ctx, exportPath, params)
 }
 
 // ExportReconciliation retrieves the final reconciliation for a given a date
@@ -622,6 +954,12 @@ func (p *DirectLinkClient) ExportChargebacks(startDate, endDate, destination, co
 //
 // See https://developer.be2bill.com/functions/exportReconciliation
 func (p *DirectLinkClient) ExportReconciliation(date, destination, compression string, options Options) (Result, error) {
+	return p.ExportReconciliationContext(context.Background(), date, destination, compression, options)
+}
+
+// ExportReconciliationContext is like ExportReconciliation but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) ExportReconciliationContext(ctx context.Context, date, destination, compression string, options Options) (Result, error) {
 	params := options.copy()
 
 	params[ParamOperationType] = OperationTypeExportReconciliation
@@ -638,9 +976,9 @@ func (p *DirectLinkClient) ExportReconciliation(date, destination, compression s
 		params[ParamMailTo] = destination
 	}
 
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	params[ParamHash] = p.signer().Sign(params)
 
-	return p.requests(p.getURLs(reconciliationPath), params)
+	return p.requests(ctx, reconciliationPath, params)
 }
 
 // ExportReconciledTransactions retrieves the collected transactions for a given day
@@ -652,6 +990,12 @@ func (p *DirectLinkClient) ExportReconciliation(date, destination, compression s
 //
 // See https://developer.be2bill.com/functions/exportReconciledTransactions
 func (p *DirectLinkClient) ExportReconciledTransactions(date, destination, compression string, options Options) (Result, error) {
+	return p.ExportReconciledTransactionsContext(context.Background(), date, destination, compression, options)
+}
+
+// ExportReconciledTransactionsContext is like ExportReconciledTransactions but uses the given context
+// to cancel the request or set a deadline on it.
+func (p *DirectLinkClient) ExportReconciledTransactionsContext(ctx context.Context, date, destination, compression string, options Options) (Result, error) {
 	params := options.copy()
 
 	params[ParamOperationType] = OperationTypeExportReconciledTransactions
@@ -668,7 +1012,7 @@ func (p *DirectLinkClient) ExportReconciledTransactions(date, destination, compr
 		params[ParamMailTo] = destination
 	}
 
-	params[ParamHash] = p.hasher.ComputeHash(p.credentials.password, params)
+	params[ParamHash] = p.signer().Sign(params)
 
-	return p.requests(p.getURLs(reconciliationPath), params)
+	return p.requests(ctx, reconciliationPath, params)
 }
@@ -6,13 +6,16 @@ package be2bill
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -166,6 +169,50 @@ func TestServerFallback(t *testing.T) {
 	}
 }
 
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestCustomHTTPClient(t *testing.T) {
+	var hosts []string
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		hosts = append(hosts, r.URL.Host)
+
+		// primary server fails, failover server answers
+		if r.URL.Host == "primary.example.org" {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Body:       ioutil.NopCloser(strings.NewReader("internal server error")),
+				Request:    r,
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"OPERATIONTYPE":"capture","TRANSACTIONID":"ABCDE01","EXECCODE":"0000","MESSAGE":"ok"}`)),
+			Request:    r,
+		}, nil
+	})
+
+	env := Environment{"https://primary.example.org", "https://failover.example.org"}
+
+	c := NewDirectLinkClient(User("foo", "bar", env))
+	c.HTTPClient = &http.Client{Transport: transport}
+
+	r, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if r.ExecCode() != ExecCodeSuccess {
+		t.Errorf("exec code %s, message: %s", r.ExecCode(), r.Message())
+	}
+
+	if len(hosts) != 2 || hosts[0] != "primary.example.org" || hosts[1] != "failover.example.org" {
+		t.Errorf("unexpected requested hosts: %v", hosts)
+	}
+}
+
 func TestConnectionError(t *testing.T) {
 	// arbitrary url
 	env := Environment{"http://127.0.0.1:61256"}
@@ -272,6 +319,86 @@ func TestServerTimeout(t *testing.T) {
 	}
 }
 
+func TestContextCanceled(t *testing.T) {
+	done := make(chan struct{})
+
+	// test server that never replies before the client gives up
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	env := Environment{ts.URL}
+
+	c := NewDirectLinkClient(User("foo", "bar", env))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	r, err := c.CaptureContext(ctx, "A151621", "order_1423675675", "capture", Options{})
+	if err != context.Canceled {
+		t.Errorf("got error: %v", err)
+	}
+	if r != nil {
+		t.Error("r should be nil")
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	done := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	env := Environment{ts.URL}
+
+	c := NewDirectLinkClient(User("foo", "bar", env))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	r, err := c.StopNTimesContext(ctx, "A151621", Options{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got error: %v", err)
+	}
+	if r != nil {
+		t.Error("r should be nil")
+	}
+}
+
+func TestContextStopsFailover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// first server cancels the context then fails
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	// second server must never be reached
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("failover server should not be called")
+	}))
+	defer ts2.Close()
+
+	env := Environment{ts.URL, ts2.URL}
+
+	c := NewDirectLinkClient(User("foo", "bar", env))
+
+	r, err := c.RefundContext(ctx, "A151621", "order_1423675675", "refund", Options{})
+	if err != context.Canceled {
+		t.Errorf("got error: %v", err)
+	}
+	if r != nil {
+		t.Error("r should be nil")
+	}
+}
+
 func TestServerCloseConnection(t *testing.T) {
 	// test server that forcefully closes all connections when handling a request
 	var ts *httptest.Server
@@ -63,8 +63,77 @@ Then, for example to capture a previously authorized transaction, call:
 		be2bill.Options{},
 	)
 
+Every operation also has a variant taking a context.Context as its first
+parameter, which can be used to cancel a request or to set a deadline on it:
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := client.CaptureContext(
+		ctx,
+		"A151621",
+		"order_1423675675",
+		"capture_transaction_A151621",
+		be2bill.Options{},
+	)
+
+Transactions can also be described using request structures with named
+fields, which are validated before being sent, unlike the parameters of
+the positional methods such as Payment:
+
+	result, err := client.ProcessPayment(ctx, &be2bill.PaymentRequest{
+		Card: be2bill.Card{
+			PAN:          "1111222233334444",
+			ValidityDate: "01-30",
+			CVV:          "123",
+			FullName:     "John Smith",
+		},
+		Amount: be2bill.SingleAmount(15235),
+		Order: be2bill.Order{
+			OrderID:         "order_1412327697",
+			ClientID:        "6328_john.smith@example.org",
+			ClientEmail:     "john.smith@example.org",
+			ClientIP:        "123.123.123.123",
+			Description:     "Fashion jacket",
+			ClientUserAgent: "Mozilla/5.0",
+		},
+	})
+
+Operations failing because of a transient error can be retried with
+an exponential backoff by setting a retry policy on the client.
+Payments, authorizations, credits, captures and refunds are only retried
+when it is certain that no transaction was created:
+
+	client.RetryPolicy = be2bill.DefaultRetryPolicy()
+	client.RetryPolicy.Confirm = be2bill.ConfirmByOrderID(client, "https://example.org/exports")
+
+By default, the URLs of the environment are tried in order for every request.
+An endpoint selector can instead balance the requests between the servers,
+and bench a failing server for a while:
+
+	client.Selector = be2bill.NewEndpointSelector(
+		be2bill.EnvProduction,
+		be2bill.StrategyPriority,
+		be2bill.CircuitBreaker{FailureThreshold: 3, Cooldown: time.Minute},
+	)
+
 Please note that access to the Direct Link Client API is not enabled by default.
 This service can only be activated by your account manager based on specific
 criteria. Please contact him or the support team for more information.
+
+Notifications
+
+After a form payment, a 3-D Secure authentication or a scheduled payment,
+the be2bill servers send the result of the transaction to the merchant
+notification URL. A NotificationHandler verifies these notifications
+and acknowledges them:
+
+	handler := be2bill.NewNotificationHandler(
+		be2bill.SandboxUser("test", "password"),
+		func(r *http.Request, result be2bill.Result) error {
+			return saveTransaction(result.TransactionID(), result.ExecCode())
+		},
+	)
+	http.Handle("/be2bill/notification", handler)
 */
 package be2bill
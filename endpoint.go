@@ -0,0 +1,234 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An EndpointStrategy determines the order in which an EndpointSelector
+// tries the URLs of an environment.
+type EndpointStrategy int
+
+const (
+	// StrategyPriority tries the URLs in the order of the environment.
+	// Once a URL fails, the next one is preferred until it fails in turn,
+	// so requests stick to a working failover server.
+	StrategyPriority EndpointStrategy = iota
+	// StrategyRoundRobin spreads the requests evenly between the URLs.
+	StrategyRoundRobin
+	// StrategyLatency prefers the URLs with the lowest average response time.
+	// URLs that have not answered yet are tried first.
+	StrategyLatency
+)
+
+// latencyWeight is the weight of the last response time in the average
+// latency of an endpoint.
+const latencyWeight = 0.2
+
+// A CircuitBreaker describes when a failing endpoint is benched.
+// A benched endpoint is not used until its cooldown period expires,
+// unless every endpoint of the environment is benched.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures after which
+	// an endpoint is benched. A zero value disables the circuit breaker.
+	FailureThreshold int
+	// Cooldown is the duration during which a benched endpoint is not used.
+	// After that, the endpoint is tried again and benched immediately
+	// if it still fails.
+	Cooldown time.Duration
+}
+
+// EndpointHealth describes the current state of an endpoint.
+type EndpointHealth struct {
+	// URL is the base URL of the endpoint.
+	URL string
+	// Available is false while the endpoint is benched.
+	Available bool
+	// Failures is the number of consecutive failed requests.
+	Failures int
+	// Latency is the average response time of the successful requests.
+	Latency time.Duration
+	// BenchedUntil is the end of the cooldown period of the endpoint,
+	// if it has been benched.
+	BenchedUntil time.Time
+	// LastError is the error returned by the last failed request,
+	// or nil if the last request succeeded.
+	LastError error
+}
+
+// An EndpointSelector chooses the URLs used by a DirectLinkClient
+// to send its requests.
+//
+// Implementations must be safe for concurrent use, as a selector can be
+// shared by several clients.
+type EndpointSelector interface {
+	// Endpoints returns the base URLs to try for the next request, in order.
+	Endpoints() []string
+	// Report records the outcome of a request sent to the given base URL.
+	// The error is nil if the server answered.
+	Report(url string, err error, latency time.Duration)
+	// Health returns the current state of each URL of the environment.
+	Health() []EndpointHealth
+}
+
+type endpointState struct {
+	url          string
+	failures     int
+	latency      time.Duration
+	benchedUntil time.Time
+	lastErr      error
+}
+
+func (p *endpointState) benched(now time.Time) bool {
+	return now.Before(p.benchedUntil)
+}
+
+type endpointSelector struct {
+	mu        sync.Mutex
+	strategy  EndpointStrategy
+	breaker   CircuitBreaker
+	endpoints []*endpointState
+	// next is the preferred endpoint for StrategyPriority,
+	// and the request counter for StrategyRoundRobin.
+	next int
+	now  func() time.Time
+}
+
+// NewEndpointSelector returns a new EndpointSelector for the URLs of
+// the given environment, using the given strategy and circuit breaker.
+func NewEndpointSelector(env Environment, strategy EndpointStrategy, breaker CircuitBreaker) EndpointSelector {
+	endpoints := make([]*endpointState, len(env))
+	for i, url := range env {
+		endpoints[i] = &endpointState{url: url}
+	}
+
+	return &endpointSelector{
+		strategy:  strategy,
+		breaker:   breaker,
+		endpoints: endpoints,
+		now:       time.Now,
+	}
+}
+
+func (p *endpointSelector) Endpoints() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	urls := make([]string, 0, len(p.endpoints))
+	var benched []string
+	for _, e := range p.order() {
+		if e.benched(now) {
+			benched = append(benched, e.url)
+		} else {
+			urls = append(urls, e.url)
+		}
+	}
+
+	// when every endpoint is benched, try them anyway rather than failing
+	if len(urls) == 0 {
+		return benched
+	}
+	return urls
+}
+
+// order returns the endpoints sorted according to the strategy.
+func (p *endpointSelector) order() []*endpointState {
+	n := len(p.endpoints)
+	if n == 0 {
+		return nil
+	}
+
+	switch p.strategy {
+	case StrategyLatency:
+		order := make([]*endpointState, n)
+		copy(order, p.endpoints)
+		sort.SliceStable(order, func(i, j int) bool {
+			return order[i].latency < order[j].latency
+		})
+		return order
+	case StrategyRoundRobin:
+		start := p.next % n
+		p.next++
+		return p.rotate(start)
+	default:
+		return p.rotate(p.next % n)
+	}
+}
+
+// rotate returns the endpoints starting from the given index.
+func (p *endpointSelector) rotate(start int) []*endpointState {
+	order := make([]*endpointState, 0, len(p.endpoints))
+	order = append(order, p.endpoints[start:]...)
+	return append(order, p.endpoints[:start]...)
+}
+
+func (p *endpointSelector) Report(url string, err error, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	index := -1
+	for i, e := range p.endpoints {
+		if e.url == url {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+	e := p.endpoints[index]
+
+	if err == nil {
+		e.failures = 0
+		e.lastErr = nil
+		e.benchedUntil = time.Time{}
+		if e.latency == 0 {
+			e.latency = latency
+		} else {
+			e.latency += time.Duration(latencyWeight * float64(latency-e.latency))
+		}
+		return
+	}
+
+	// the caller giving up says nothing about the endpoint
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return
+	}
+
+	e.failures++
+	e.lastErr = err
+	if p.breaker.FailureThreshold > 0 && e.failures >= p.breaker.FailureThreshold {
+		e.benchedUntil = p.now().Add(p.breaker.Cooldown)
+	}
+
+	// fail over to the next endpoint for the following requests
+	if p.strategy == StrategyPriority && index == p.next%len(p.endpoints) {
+		p.next = (index + 1) % len(p.endpoints)
+	}
+}
+
+func (p *endpointSelector) Health() []EndpointHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	health := make([]EndpointHealth, len(p.endpoints))
+	for i, e := range p.endpoints {
+		health[i] = EndpointHealth{
+			URL:          e.url,
+			Available:    !e.benched(now),
+			Failures:     e.failures,
+			Latency:      e.latency,
+			BenchedUntil: e.benchedUntil,
+			LastError:    e.lastErr,
+		}
+	}
+	return health
+}
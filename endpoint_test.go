@@ -0,0 +1,178 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testEnv = Environment{
+	"https://secure-magenta1.example.org",
+	"https://secure-magenta2.example.org",
+	"https://secure-magenta3.example.org",
+}
+
+// testSelector returns a selector whose clock is controlled by the test.
+func testSelector(strategy EndpointStrategy, breaker CircuitBreaker) (*endpointSelector, *time.Time) {
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewEndpointSelector(testEnv, strategy, breaker).(*endpointSelector)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func checkEndpoints(s EndpointSelector, expected []string, t *testing.T) {
+	if urls := s.Endpoints(); !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected %v, got %v", expected, urls)
+	}
+}
+
+func TestStrategyPriority(t *testing.T) {
+	s, _ := testSelector(StrategyPriority, CircuitBreaker{})
+
+	checkEndpoints(s, []string{testEnv[0], testEnv[1], testEnv[2]}, t)
+	s.Report(testEnv[0], nil, time.Millisecond)
+	checkEndpoints(s, []string{testEnv[0], testEnv[1], testEnv[2]}, t)
+
+	// sticks to the failover endpoint
+	s.Report(testEnv[0], ErrServerError, time.Millisecond)
+	checkEndpoints(s, []string{testEnv[1], testEnv[2], testEnv[0]}, t)
+	s.Report(testEnv[1], nil, time.Millisecond)
+	checkEndpoints(s, []string{testEnv[1], testEnv[2], testEnv[0]}, t)
+
+	// failures of other endpoints are ignored
+	s.Report(testEnv[2], ErrServerError, time.Millisecond)
+	checkEndpoints(s, []string{testEnv[1], testEnv[2], testEnv[0]}, t)
+}
+
+func TestStrategyRoundRobin(t *testing.T) {
+	s, _ := testSelector(StrategyRoundRobin, CircuitBreaker{})
+
+	checkEndpoints(s, []string{testEnv[0], testEnv[1], testEnv[2]}, t)
+	checkEndpoints(s, []string{testEnv[1], testEnv[2], testEnv[0]}, t)
+	checkEndpoints(s, []string{testEnv[2], testEnv[0], testEnv[1]}, t)
+	checkEndpoints(s, []string{testEnv[0], testEnv[1], testEnv[2]}, t)
+}
+
+func TestStrategyLatency(t *testing.T) {
+	s, _ := testSelector(StrategyLatency, CircuitBreaker{})
+
+	s.Report(testEnv[0], nil, 300*time.Millisecond)
+	s.Report(testEnv[1], nil, 100*time.Millisecond)
+
+	// the endpoint without measure is tried first
+	checkEndpoints(s, []string{testEnv[2], testEnv[1], testEnv[0]}, t)
+
+	s.Report(testEnv[2], nil, 200*time.Millisecond)
+	checkEndpoints(s, []string{testEnv[1], testEnv[2], testEnv[0]}, t)
+
+	// the average moves towards the last response times
+	for i := 0; i < 10; i++ {
+		s.Report(testEnv[1], nil, time.Second)
+	}
+	checkEndpoints(s, []string{testEnv[2], testEnv[0], testEnv[1]}, t)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	s, now := testSelector(StrategyRoundRobin, CircuitBreaker{
+		FailureThreshold: 2,
+		Cooldown:         time.Minute,
+	})
+
+	s.Report(testEnv[1], ErrTimeout, time.Second)
+	if h := s.Health()[1]; !h.Available || h.Failures != 1 || h.LastError != ErrTimeout {
+		t.Errorf("unexpected health: %+v", h)
+	}
+
+	s.Report(testEnv[1], ErrTimeout, time.Second)
+	h := s.Health()[1]
+	if h.Available || h.Failures != 2 || !h.BenchedUntil.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected health: %+v", h)
+	}
+	checkEndpoints(s, []string{testEnv[0], testEnv[2]}, t)
+
+	// cancellations do not count as failures
+	s.Report(testEnv[0], context.Canceled, time.Second)
+	s.Report(testEnv[0], context.Canceled, time.Second)
+	if h := s.Health()[0]; !h.Available || h.Failures != 0 {
+		t.Errorf("unexpected health: %+v", h)
+	}
+
+	// back after the cooldown, and benched again on the first failure
+	*now = now.Add(time.Minute)
+	if h := s.Health()[1]; !h.Available {
+		t.Errorf("unexpected health: %+v", h)
+	}
+	s.Report(testEnv[1], ErrServerError, time.Second)
+	if h := s.Health()[1]; h.Available {
+		t.Errorf("unexpected health: %+v", h)
+	}
+
+	// closed again on success
+	s.Report(testEnv[1], nil, time.Second)
+	if h := s.Health()[1]; !h.Available || h.Failures != 0 || h.LastError != nil {
+		t.Errorf("unexpected health: %+v", h)
+	}
+}
+
+func TestAllEndpointsBenched(t *testing.T) {
+	s, _ := testSelector(StrategyPriority, CircuitBreaker{
+		FailureThreshold: 1,
+		Cooldown:         time.Minute,
+	})
+
+	for _, url := range testEnv {
+		s.Report(url, ErrServerError, time.Second)
+	}
+	if urls := s.Endpoints(); len(urls) != len(testEnv) {
+		t.Errorf("expected all endpoints, got %v", urls)
+	}
+}
+
+func TestClientSelector(t *testing.T) {
+	var calls []string
+	handler := func(name string, status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, name)
+			if status != http.StatusOK {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			fmt.Fprint(w, `{"OPERATIONTYPE":"capture","TRANSACTIONID":"ABCDE01","EXECCODE":"0000","MESSAGE":"ok"}`)
+		}
+	}
+	ts := httptest.NewServer(handler("primary", http.StatusInternalServerError))
+	defer ts.Close()
+	ts2 := httptest.NewServer(handler("failover", http.StatusOK))
+	defer ts2.Close()
+
+	env := Environment{ts.URL, ts2.URL}
+	c := NewDirectLinkClient(User("foo", "bar", env))
+	c.Selector = NewEndpointSelector(env, StrategyPriority, CircuitBreaker{})
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Capture("A151621", "order_1423675675", "capture", Options{}); err != nil {
+			t.Fatal("got error: ", err)
+		}
+	}
+
+	// the second request goes directly to the failover server
+	if !reflect.DeepEqual(calls, []string{"primary", "failover", "failover"}) {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+
+	health := c.Selector.Health()
+	if health[0].Failures != 1 || health[0].LastError != ErrServerError {
+		t.Errorf("unexpected primary health: %+v", health[0])
+	}
+	if health[1].Failures != 0 || health[1].Latency == 0 {
+		t.Errorf("unexpected failover health: %+v", health[1])
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxErrorBodySize is the maximum number of bytes of a response body
+// kept in an HTTPError.
+const maxErrorBodySize = 512
+
+// These errors can be compared to the errors returned by DirectLinkClient
+// operations using errors.Is, when the client uses strict errors.
+var (
+	ErrMissingParameter              = errors.New("missing parameter")
+	ErrInvalidParameter              = errors.New("invalid parameter")
+	ErrAliasNotFound                 = errors.New("alias not found")
+	ErrTransactionNotFound           = errors.New("transaction not found")
+	ErrTransactionNotRefundable      = errors.New("transaction not refundable")
+	ErrAuthorizationNotCapturable    = errors.New("authorization not capturable")
+	ErrInvalidAmount                 = errors.New("invalid amount")
+	ErrScheduleNotFound              = errors.New("schedule not found")
+	ErrAccountDeactivated            = errors.New("account deactivated")
+	ErrUnauthorizedServerIP          = errors.New("unauthorized server IP address")
+	ErrTransactionRefused            = errors.New("transaction refused")
+	ErrInsufficientFunds             = errors.New("insufficient funds")
+	ErrCardRefused                   = errors.New("card refused")
+	ErrSuspectedFraud                = errors.New("suspected fraud")
+	ErrCardLostOrStolen              = errors.New("card lost or stolen")
+	ErrAuthenticationFailed          = errors.New("3-D Secure authentication failed")
+	ErrDuplicateTransaction          = errors.New("duplicate transaction")
+	ErrInvalidCardData               = errors.New("invalid card data")
+	ErrNetworkError                  = errors.New("network error")
+	ErrTransactionRefusedByRiskRules = errors.New("transaction refused by anti-fraud rules")
+)
+
+// execCodeErrors associates execution codes to the error they match.
+var execCodeErrors = map[ExecCode]error{
+	ExecCodeMissingParameter:                ErrMissingParameter,
+	ExecCodeInvalidParameter:                ErrInvalidParameter,
+	ExecCodeInvalidHash:                     ErrInvalidHash,
+	ExecCodeAliasNotFound:                   ErrAliasNotFound,
+	ExecCodeTransactionNotFound:             ErrTransactionNotFound,
+	ExecCodeTransactionNotRefundable:        ErrTransactionNotRefundable,
+	ExecCodeAuthorizationNotCapturable:      ErrAuthorizationNotCapturable,
+	ExecCodeInvalidCaptureAmount:            ErrInvalidAmount,
+	ExecCodeInvalidRefundAmount:             ErrInvalidAmount,
+	ExecCodeScheduleNotFound:                ErrScheduleNotFound,
+	ExecCodeAccountDeactivated:              ErrAccountDeactivated,
+	ExecCodeUnauthorizedServerIP:            ErrUnauthorizedServerIP,
+	ExecCodeTransactionRefusedBank:          ErrTransactionRefused,
+	ExecCodeUnsufficientFunds:               ErrInsufficientFunds,
+	ExecCodeCardRefused:                     ErrCardRefused,
+	ExecCodeSuspectedFraud:                  ErrSuspectedFraud,
+	ExecCodeCardLost:                        ErrCardLostOrStolen,
+	ExecCodeCardStolen:                      ErrCardLostOrStolen,
+	ExecCode3DSecureAuthenticationFailed:    ErrAuthenticationFailed,
+	ExecCodeDuplicateTransaction:            ErrDuplicateTransaction,
+	ExecCodeInvalidCardData:                 ErrInvalidCardData,
+	ExecCodeExchangeProtocolError:           ErrNetworkError,
+	ExecCodeBankNetworkError:                ErrNetworkError,
+	ExecCodeHandlerTimeout:                  ErrNetworkError,
+	ExecCodeTransactionRefusedMerchantRules: ErrTransactionRefusedByRiskRules,
+}
+
+// An ExecError is returned by DirectLinkClient operations using strict
+// errors when the server returns an execution code denoting a failure.
+//
+// ExecError values match the be2bill.Err* variables associated with their
+// execution code when compared with errors.Is.
+//
+// Like every error returned by this package, an ExecError never contains
+// card data: its Result is a masked copy of the result of the operation.
+type ExecError struct {
+	Result Result
+}
+
+func newExecError(result Result) *ExecError {
+	return &ExecError{result.Masked()}
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("exec code %s: %s", e.Result.ExecCode(), e.Result.Message())
+}
+
+// ExecCode returns the execution code of the result.
+func (e *ExecError) ExecCode() ExecCode {
+	return e.Result.ExecCode()
+}
+
+// Is reports whether the error matches target.
+func (e *ExecError) Is(target error) bool {
+	err, ok := execCodeErrors[e.Result.ExecCode()]
+	return ok && err == target
+}
+
+// An HTTPError is returned by DirectLinkClient operations using strict errors
+// when the server answers with an unexpected HTTP status.
+//
+// HTTPError values match ErrServerError when compared with errors.Is.
+type HTTPError struct {
+	StatusCode int
+	// Body is the beginning of the response body, with any card data masked.
+	Body string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("server error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports whether the error matches target.
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrServerError
+}
+
+func newHTTPError(resp *http.Response) *HTTPError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Body:       MaskCardData(string(body)),
+	}
+}
+
+// isFailure returns true if the result denotes a failed operation.
+// Operations that require an action from the customer are not failures.
+func isFailure(r Result) bool {
+	switch r.ExecCode().Category() {
+	case ExecCodeCategorySuccess, ExecCodeCategoryActionRequired:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func execCodeServer(execCode ExecCode) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"OPERATIONTYPE":"capture","TRANSACTIONID":"ABCDE01","EXECCODE":"%s","MESSAGE":"message"}`, execCode)
+	}))
+}
+
+func TestStrictErrorsExecCode(t *testing.T) {
+	testCases := []struct {
+		execCode ExecCode
+		target   error
+	}{
+		{ExecCodeCardRefused, ErrCardRefused},
+		{ExecCodeInvalidHash, ErrInvalidHash},
+		{ExecCodeTransactionNotFound, ErrTransactionNotFound},
+		{ExecCodeCardStolen, ErrCardLostOrStolen},
+		{ExecCodeBankNetworkError, ErrNetworkError},
+		{ExecCodeInterruptedSchedule, nil},
+	}
+
+	for _, tc := range testCases {
+		ts := execCodeServer(tc.execCode)
+
+		c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+		c.StrictErrors = true
+
+		r, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+		ts.Close()
+
+		var execErr *ExecError
+		if !errors.As(err, &execErr) {
+			t.Errorf("%s: expected an ExecError, got %v", tc.execCode, err)
+			continue
+		}
+		if execErr.ExecCode() != tc.execCode {
+			t.Errorf("%s: unexpected exec code %s", tc.execCode, execErr.ExecCode())
+		}
+		if tc.target != nil && !errors.Is(err, tc.target) {
+			t.Errorf("%s: error does not match %v", tc.execCode, tc.target)
+		}
+		if errors.Is(err, ErrSuspectedFraud) {
+			t.Errorf("%s: error should not match %v", tc.execCode, ErrSuspectedFraud)
+		}
+		if r == nil || r.ExecCode() != tc.execCode {
+			t.Errorf("%s: unexpected result %v", tc.execCode, r)
+		}
+		if err.Error() != fmt.Sprintf("exec code %s: message", tc.execCode) {
+			t.Errorf("%s: unexpected message: %s", tc.execCode, err)
+		}
+	}
+}
+
+func TestStrictErrorsSuccess(t *testing.T) {
+	for _, execCode := range []ExecCode{ExecCodeSuccess, ExecCode3DSecureRequired} {
+		ts := execCodeServer(execCode)
+
+		c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+		c.StrictErrors = true
+
+		r, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+		ts.Close()
+
+		if err != nil {
+			t.Errorf("%s: got error: %v", execCode, err)
+		}
+		if r.ExecCode() != execCode {
+			t.Errorf("%s: unexpected result %v", execCode, r)
+		}
+	}
+}
+
+func TestNonStrictErrors(t *testing.T) {
+	ts := execCodeServer(ExecCodeCardRefused)
+	defer ts.Close()
+
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+
+	r, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if r.ExecCode() != ExecCodeCardRefused {
+		t.Errorf("unexpected result %v", r)
+	}
+}
+
+func TestStrictErrorsHTTPStatus(t *testing.T) {
+	body := strings.Repeat("x", 2*maxErrorBodySize)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, body, http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+	c.StrictErrors = true
+
+	r, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+	if r != nil {
+		t.Error("r should be nil")
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+	if httpErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("unexpected status: %d", httpErr.StatusCode)
+	}
+	if httpErr.Body != body[:maxErrorBodySize] {
+		t.Errorf("unexpected body length: %d", len(httpErr.Body))
+	}
+	if !errors.Is(err, ErrServerError) {
+		t.Error("error should match ErrServerError")
+	}
+	if err.Error() != "server error: 502 Bad Gateway" {
+		t.Errorf("unexpected message: %s", err)
+	}
+}
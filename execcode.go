@@ -0,0 +1,109 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+// An ExecCode is the execution code returned by the be2bill servers,
+// that represents the success status of an operation.
+//
+// The be2bill.ExecCode* constants represent the known execution codes.
+// See https://developer.be2bill.com/annexes/execcodes for more information.
+type ExecCode string
+
+// An ExecCodeCategory is a family of execution codes, given by the first
+// digit of the code.
+type ExecCodeCategory int
+
+// These constants represent the categories of execution codes.
+const (
+	// ExecCodeCategoryUnknown is the category of unknown execution codes.
+	ExecCodeCategoryUnknown ExecCodeCategory = iota
+	// ExecCodeCategorySuccess is the category of successful operations.
+	ExecCodeCategorySuccess
+	// ExecCodeCategoryActionRequired is the category of operations that need
+	// an action from the customer, such as a 3-D Secure authentication
+	// or a redirection (0001 and 0002).
+	ExecCodeCategoryActionRequired
+	// ExecCodeCategoryRequestError is the category of invalid requests (1xxx).
+	ExecCodeCategoryRequestError
+	// ExecCodeCategoryTransactionState is the category of operations that
+	// are not compatible with the state of a transaction (2xxx).
+	ExecCodeCategoryTransactionState
+	// ExecCodeCategoryAccount is the category of errors related to
+	// the merchant account (3xxx).
+	ExecCodeCategoryAccount
+	// ExecCodeCategoryBankRefusal is the category of transactions refused
+	// by the bank (4xxx).
+	ExecCodeCategoryBankRefusal
+	// ExecCodeCategoryNetwork is the category of technical errors between
+	// be2bill and the banking network (5xxx).
+	ExecCodeCategoryNetwork
+	// ExecCodeCategoryRisk is the category of transactions refused by
+	// the anti-fraud rules (6xxx).
+	ExecCodeCategoryRisk
+)
+
+var execCodeCategoryNames = []string{
+	ExecCodeCategoryUnknown:          "unknown",
+	ExecCodeCategorySuccess:          "success",
+	ExecCodeCategoryActionRequired:   "action required",
+	ExecCodeCategoryRequestError:     "request error",
+	ExecCodeCategoryTransactionState: "transaction state",
+	ExecCodeCategoryAccount:          "account",
+	ExecCodeCategoryBankRefusal:      "bank refusal",
+	ExecCodeCategoryNetwork:          "network",
+	ExecCodeCategoryRisk:             "risk",
+}
+
+func (c ExecCodeCategory) String() string {
+	if c < 0 || int(c) >= len(execCodeCategoryNames) {
+		return execCodeCategoryNames[ExecCodeCategoryUnknown]
+	}
+	return execCodeCategoryNames[c]
+}
+
+// Category returns the category of the execution code.
+func (c ExecCode) Category() ExecCodeCategory {
+	switch c {
+	case ExecCodeSuccess:
+		return ExecCodeCategorySuccess
+	case ExecCode3DSecureRequired, ExecCodeAlternateRedirectRequired:
+		return ExecCodeCategoryActionRequired
+	}
+
+	if len(c) != 4 || !isDigits(string(c)) {
+		return ExecCodeCategoryUnknown
+	}
+
+	switch c[0] {
+	case '1':
+		return ExecCodeCategoryRequestError
+	case '2':
+		return ExecCodeCategoryTransactionState
+	case '3':
+		return ExecCodeCategoryAccount
+	case '4':
+		return ExecCodeCategoryBankRefusal
+	case '5':
+		return ExecCodeCategoryNetwork
+	case '6':
+		return ExecCodeCategoryRisk
+	}
+	return ExecCodeCategoryUnknown
+}
+
+// Success returns true if the execution code represents a successful operation.
+func (c ExecCode) Success() bool {
+	return c == ExecCodeSuccess
+}
+
+// Retryable returns true if the execution code represents a transient
+// error, after which the same operation can be attempted again.
+func (c ExecCode) Retryable() bool {
+	switch c {
+	case ExecCodeExchangeProtocolError, ExecCodeBankNetworkError, ExecCodeHandlerTimeout:
+		return true
+	}
+	return false
+}
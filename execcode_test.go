@@ -0,0 +1,64 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import "testing"
+
+func TestExecCodeCategory(t *testing.T) {
+	testCases := []struct {
+		code      ExecCode
+		category  ExecCodeCategory
+		retryable bool
+	}{
+		{ExecCodeSuccess, ExecCodeCategorySuccess, false},
+		{ExecCode3DSecureRequired, ExecCodeCategoryActionRequired, false},
+		{ExecCodeAlternateRedirectRequired, ExecCodeCategoryActionRequired, false},
+		{ExecCodeInvalidHash, ExecCodeCategoryRequestError, false},
+		{ExecCodeTransactionNotFound, ExecCodeCategoryTransactionState, false},
+		{ExecCodeAccountDeactivated, ExecCodeCategoryAccount, false},
+		{ExecCodeCardRefused, ExecCodeCategoryBankRefusal, false},
+		{ExecCodeExchangeProtocolError, ExecCodeCategoryNetwork, true},
+		{ExecCodeBankNetworkError, ExecCodeCategoryNetwork, true},
+		{ExecCodeHandlerTimeout, ExecCodeCategoryNetwork, true},
+		{ExecCode3DSecureDisplayError, ExecCodeCategoryNetwork, false},
+		{ExecCodeTransactionChallenged, ExecCodeCategoryRisk, false},
+		{"0003", ExecCodeCategoryUnknown, false},
+		{"9001", ExecCodeCategoryUnknown, false},
+		{"40", ExecCodeCategoryUnknown, false},
+		{"4a01", ExecCodeCategoryUnknown, false},
+		{"", ExecCodeCategoryUnknown, false},
+	}
+
+	for _, tc := range testCases {
+		if c := tc.code.Category(); c != tc.category {
+			t.Errorf("%s: expected category %s, got %s", tc.code, tc.category, c)
+		}
+		if r := tc.code.Retryable(); r != tc.retryable {
+			t.Errorf("%s: expected retryable %v, got %v", tc.code, tc.retryable, r)
+		}
+	}
+}
+
+func TestExecCodeCategoryString(t *testing.T) {
+	if s := ExecCodeCategoryBankRefusal.String(); s != "bank refusal" {
+		t.Errorf("unexpected name: %s", s)
+	}
+	if s := ExecCodeCategory(42).String(); s != "unknown" {
+		t.Errorf("unexpected name: %s", s)
+	}
+}
+
+func TestResultExecCode(t *testing.T) {
+	r := Result{ResultParamExecCode: "4003"}
+	if r.ExecCode() != ExecCodeCardRefused {
+		t.Errorf("unexpected exec code: %s", r.ExecCode())
+	}
+	if r.ExecCode().Category() != ExecCodeCategoryBankRefusal {
+		t.Errorf("unexpected category: %s", r.ExecCode().Category())
+	}
+	if r.Success() {
+		t.Error("invalid success status")
+	}
+}
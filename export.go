@@ -0,0 +1,338 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultMaxExportSize is the maximum size of an export file, in bytes.
+	defaultMaxExportSize = 100 << 20
+	// defaultMaxDecompressedExportSize is the maximum size of the
+	// decompressed content of an export file, in bytes.
+	defaultMaxDecompressedExportSize = 1 << 30
+	// maxExportMemory is the maximum size of an uploaded export file kept
+	// in memory, larger files are stored on disk.
+	maxExportMemory = 32 << 20
+)
+
+var (
+	// ErrEmptyExport is returned when an uploaded export contains no file.
+	ErrEmptyExport = errors.New("empty export file")
+	// ErrUnsupportedCompression is returned when the compression format of
+	// an uploaded export is not supported.
+	ErrUnsupportedCompression = errors.New("unsupported compression format")
+	// ErrExportTooLarge is returned when an uploaded export, or its
+	// decompressed content, is larger than the maximum size of the handler.
+	ErrExportTooLarge = errors.New("export file too large")
+)
+
+// An ExportFile represents a file sent by the be2bill servers to the
+// callback URL given to an export or transaction search operation.
+type ExportFile struct {
+	// OperationType is the operation that produced the file,
+	// as specified in the be2bill.OperationType* constants.
+	OperationType string
+	// Identifier is the be2bill account identifier.
+	Identifier string
+	// Date is the exported date, for operations on a single date.
+	Date string
+	// StartDate and EndDate are the bounds of the exported dates,
+	// for operations on an interval.
+	StartDate string
+	EndDate   string
+	// Compression is the compression format of the uploaded file, as
+	// specified in the be2bill.Compression* constants, or an empty string
+	// if the file was not compressed.
+	Compression string
+	// Filename is the name of the uploaded file, or of the file extracted
+	// from the archive for ZIP files.
+	Filename string
+	// Body is the decompressed content of the file.
+	// Reading past the maximum decompressed size of the handler
+	// returns ErrExportTooLarge.
+	Body io.Reader
+}
+
+// An ExportFunc is called by an ExportHandler for every received export file.
+type ExportFunc func(r *http.Request, file *ExportFile) error
+
+// An ExportHandler is an http.Handler that receives the export files sent
+// to a callback URL by the ExportTransactions, ExportChargebacks,
+// ExportReconciliation, ExportReconciledTransactions and GetTransactionsBy*
+// operations.
+//
+// The file can be uploaded as part of a multipart form, or as the raw body
+// of the request. Its compression format is taken from the COMPRESSION
+// parameter if present, otherwise it is detected from its content.
+// The file is decompressed before being passed to the user callback.
+//
+// Requests that cannot be parsed are answered with a 400 Bad Request status,
+// and requests for which the callback returns an error with
+// a 500 Internal Server Error status.
+type ExportHandler struct {
+	handler ExportFunc
+	// MaxSize is the maximum size in bytes of an uploaded file.
+	// If zero or negative, the default maximum size of 100 MB is used.
+	MaxSize int64
+	// MaxDecompressedSize is the maximum size in bytes of the decompressed
+	// content of a file, past which reading its Body fails.
+	// If zero or negative, the default maximum size of 1 GB is used.
+	MaxDecompressedSize int64
+	// ErrorHandler, if not nil, is called with the request and the error
+	// every time an upload is rejected.
+	ErrorHandler func(r *http.Request, err error)
+}
+
+// NewExportHandler returns a new ExportHandler calling handler for each
+// received file.
+func NewExportHandler(handler ExportFunc) *ExportHandler {
+	return &ExportHandler{
+		handler:             handler,
+		MaxSize:             defaultMaxExportSize,
+		MaxDecompressedSize: defaultMaxDecompressedExportSize,
+	}
+}
+
+func (p *ExportHandler) maxSize() int64 {
+	if p.MaxSize > 0 {
+		return p.MaxSize
+	}
+	return defaultMaxExportSize
+}
+
+func (p *ExportHandler) maxDecompressedSize() int64 {
+	if p.MaxDecompressedSize > 0 {
+		return p.MaxDecompressedSize
+	}
+	return defaultMaxDecompressedExportSize
+}
+
+func (p *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, p.maxSize())
+
+	defer func() {
+		if r.MultipartForm != nil {
+			_ = r.MultipartForm.RemoveAll()
+		}
+	}()
+
+	file, closer, err := p.readFile(r)
+	if err != nil {
+		p.fail(w, r, &RequestError{err}, http.StatusBadRequest)
+		return
+	}
+	if closer != nil {
+		defer func() { _ = closer.Close() }()
+	}
+
+	if err := p.handler(r, file); err != nil {
+		if errors.Is(err, ErrExportTooLarge) {
+			p.fail(w, r, &RequestError{err}, http.StatusBadRequest)
+			return
+		}
+		p.fail(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, notificationAcknowledgement)
+}
+
+func (p *ExportHandler) fail(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(r, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// readFile returns the export file uploaded in the given request, and
+// the readers to close once it has been processed, if any.
+func (p *ExportHandler) readFile(r *http.Request) (file *ExportFile, closer io.Closer, err error) {
+	var body io.Reader
+	var filename string
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxExportMemory); err != nil {
+			return nil, nil, err
+		}
+
+		// use the first uploaded file
+		names := make([]string, 0, len(r.MultipartForm.File))
+		for name, headers := range r.MultipartForm.File {
+			if len(headers) > 0 {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, nil, ErrEmptyExport
+		}
+		sort.Strings(names)
+
+		header := r.MultipartForm.File[names[0]][0]
+		f, err := header.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		closer = f
+		body = f
+		filename = header.Filename
+	} else {
+		// the body is the file itself whatever its content type, so only
+		// the query is parsed, as ParseForm would consume form bodies
+		query, err := url.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.Form = query
+		body = r.Body
+	}
+
+	file = &ExportFile{
+		OperationType: r.Form.Get(ParamOperationType),
+		Identifier:    r.Form.Get(ParamIdentifier),
+		Date:          r.Form.Get(ParamDate),
+		StartDate:     r.Form.Get(ParamStartDate),
+		EndDate:       r.Form.Get(ParamEndDate),
+		Compression:   strings.ToUpper(r.Form.Get(ParamCompression)),
+		Filename:      filename,
+	}
+
+	br := bufio.NewReader(body)
+	if file.Compression == "" {
+		file.Compression = detectCompression(br)
+	}
+
+	var closers multiCloser
+	if closer != nil {
+		closers = append(closers, closer)
+	}
+	decompressor, err := file.decompress(br, p.maxSize())
+	if err != nil {
+		_ = closers.Close()
+		return nil, nil, err
+	}
+	if decompressor != nil {
+		closers = append(multiCloser{decompressor}, closers...)
+	}
+	file.Body = &sizeLimitedReader{file.Body, p.maxDecompressedSize()}
+
+	return file, closers, nil
+}
+
+// A multiCloser closes several readers in order.
+type multiCloser []io.Closer
+
+func (p multiCloser) Close() error {
+	var errRet error
+	for _, c := range p {
+		if err := c.Close(); err != nil && errRet == nil {
+			errRet = err
+		}
+	}
+	return errRet
+}
+
+// A sizeLimitedReader reads at most n bytes from r, then fails with
+// ErrExportTooLarge rather than truncating the content like io.LimitReader.
+type sizeLimitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (p *sizeLimitedReader) Read(b []byte) (int, error) {
+	if p.n < 0 {
+		return 0, ErrExportTooLarge
+	}
+	// read one more byte to tell a file of exactly n bytes from a larger one
+	if int64(len(b)) > p.n+1 {
+		b = b[:p.n+1]
+	}
+	n, err := p.r.Read(b)
+	if int64(n) > p.n {
+		n = int(p.n)
+		p.n = -1
+		return n, ErrExportTooLarge
+	}
+	p.n -= int64(n)
+	return n, err
+}
+
+// detectCompression returns the compression format of the given data,
+// using the magic number of each format.
+func detectCompression(r *bufio.Reader) string {
+	header, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return CompressionZip
+	case bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		return CompressionGzip
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return CompressionBzip
+	}
+	return ""
+}
+
+// decompress sets the body of the file to the decompressed contents of r,
+// reading at most maxSize bytes of compressed ZIP data in memory, and returns the decompressor
+// to close once the body has been read, if any.
+func (p *ExportFile) decompress(r io.Reader, maxSize int64) (io.Closer, error) {
+	switch p.Compression {
+	case "":
+		p.Body = r
+	case CompressionGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		p.Body = gr
+		return gr, nil
+	case CompressionBzip:
+		p.Body = bzip2.NewReader(r)
+	case CompressionZip:
+		// zip archives need random access
+		data, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxSize {
+			return nil, ErrExportTooLarge
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			p.Body = rc
+			p.Filename = f.Name
+			return rc, nil
+		}
+		return nil, ErrEmptyExport
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+	return nil, nil
+}
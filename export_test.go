@@ -0,0 +1,249 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const exportContents = "IDENTIFIER;TRANSACTIONID\nfoo;A151621\n"
+
+// exportContents compressed with bzip2
+var exportContentsBzip = []byte("BZh91AY&SY\x10\xe4i\xd6\x00\x00\nO\x00\x00\x103\x08/!\x9c\x00\x01\x00\xa0\x00!\xa9\xa0z\x9a\x06\x99\nd\xc4\xc8211Ck\xd8C/\xa6z2\x81\xb6\xce\x1c\xb9J\x90\xfb^G\xc5\xdc\x91N\x14$\x049\x1au\x80")
+
+func gzipData(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipData(t *testing.T, name, data string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func serveExport(t *testing.T, req *http.Request) (*ExportFile, string, *httptest.ResponseRecorder) {
+	var file *ExportFile
+	var contents []byte
+	h := NewExportHandler(func(r *http.Request, f *ExportFile) error {
+		data, err := ioutil.ReadAll(f.Body)
+		if err != nil {
+			return err
+		}
+		file, contents = f, data
+		return nil
+	})
+	h.ErrorHandler = func(r *http.Request, err error) {
+		t.Logf("rejected export: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return file, string(contents), w
+}
+
+func TestExportHandlerRawBody(t *testing.T) {
+	testCases := []struct {
+		query       string
+		body        []byte
+		compression string
+	}{
+		{"COMPRESSION=GZIP", gzipData(t, exportContents), CompressionGzip},
+		{"", gzipData(t, exportContents), CompressionGzip},
+		{"", exportContentsBzip, CompressionBzip},
+		{"COMPRESSION=ZIP", zipData(t, "export.csv", exportContents), CompressionZip},
+		{"", []byte(exportContents), ""},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/export?OPERATIONTYPE=exportTransactions&IDENTIFIER=foo&STARTDATE=2015-10&ENDDATE=2015-11&"+tc.query, bytes.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		file, contents, w := serveExport(t, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tc.compression, w.Code)
+		}
+		if contents != exportContents {
+			t.Errorf("%s: unexpected contents: %q", tc.compression, contents)
+		}
+		if file.Compression != tc.compression {
+			t.Errorf("expected compression %s, got %s", tc.compression, file.Compression)
+		}
+		if file.OperationType != OperationTypeExportTransactions {
+			t.Errorf("unexpected operation type: %s", file.OperationType)
+		}
+		if file.Identifier != "foo" || file.StartDate != "2015-10" || file.EndDate != "2015-11" {
+			t.Errorf("unexpected metadata: %+v", file)
+		}
+	}
+}
+
+func TestExportHandlerFormContentType(t *testing.T) {
+	// the file must not be consumed as a form
+	req := httptest.NewRequest("POST", "/export?OPERATIONTYPE=exportTransactions&IDENTIFIER=foo", strings.NewReader(exportContents))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	file, contents, w := serveExport(t, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	if contents != exportContents {
+		t.Errorf("unexpected contents: %q", contents)
+	}
+	if file.OperationType != OperationTypeExportTransactions || file.Identifier != "foo" {
+		t.Errorf("unexpected metadata: %+v", file)
+	}
+}
+
+func TestExportFileDecompressMaxSize(t *testing.T) {
+	data := zipData(t, "export.csv", exportContents)
+	file := &ExportFile{Compression: CompressionZip}
+	if _, err := file.decompress(bytes.NewReader(data), int64(len(data)-1)); err != ErrExportTooLarge {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	closer, err := file.decompress(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closer == nil {
+		t.Fatal("missing closer")
+	}
+	_ = closer.Close()
+}
+
+func TestExportHandlerMaxDecompressedSize(t *testing.T) {
+	const maxSize = 1 << 20
+	var handlerErr error
+	h := NewExportHandler(func(r *http.Request, f *ExportFile) error {
+		_, err := io.Copy(ioutil.Discard, f.Body)
+		return err
+	})
+	h.MaxDecompressedSize = maxSize
+	h.ErrorHandler = func(r *http.Request, err error) {
+		handlerErr = err
+	}
+
+	// a few kilobytes decompressing to more than the limit
+	bomb := gzipData(t, strings.Repeat("0", 10*maxSize))
+	if len(bomb) > maxSize/10 {
+		t.Fatalf("payload not compressible enough: %d bytes", len(bomb))
+	}
+	for _, data := range [][]byte{bomb, zipData(t, "export.csv", strings.Repeat("0", maxSize+1))} {
+		handlerErr = nil
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/export", bytes.NewReader(data)))
+		if w.Code != http.StatusBadRequest || !errors.Is(handlerErr, ErrExportTooLarge) {
+			t.Errorf("unexpected status %d, error: %v", w.Code, handlerErr)
+		}
+	}
+
+	// files of exactly the maximum size are accepted
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/export", bytes.NewReader(gzipData(t, strings.Repeat("0", maxSize)))))
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status %d, error: %v", w.Code, handlerErr)
+	}
+}
+
+func TestExportHandlerMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField(ParamOperationType, OperationTypeExportReconciliation)
+	_ = mw.WriteField(ParamDate, "2015-10-21")
+	fw, err := mw.CreateFormFile("file", "export.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(zipData(t, "reconciliation.csv", exportContents))
+	_ = mw.Close()
+
+	req := httptest.NewRequest("POST", "/export", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	file, contents, w := serveExport(t, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	if w.Body.String() != "OK" {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+	if contents != exportContents {
+		t.Errorf("unexpected contents: %q", contents)
+	}
+	if file.Compression != CompressionZip {
+		t.Errorf("unexpected compression: %s", file.Compression)
+	}
+	if file.Filename != "reconciliation.csv" {
+		t.Errorf("unexpected file name: %s", file.Filename)
+	}
+	if file.OperationType != OperationTypeExportReconciliation || file.Date != "2015-10-21" {
+		t.Errorf("unexpected metadata: %+v", file)
+	}
+}
+
+func TestExportHandlerErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		query  string
+		body   []byte
+		status int
+	}{
+		{"invalid gzip", "COMPRESSION=GZIP", []byte(exportContents), http.StatusBadRequest},
+		{"invalid zip", "COMPRESSION=ZIP", []byte(exportContents), http.StatusBadRequest},
+		{"unsupported", "COMPRESSION=RAR", []byte(exportContents), http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/export?"+tc.query, bytes.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		_, _, w := serveExport(t, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: unexpected status: %d", tc.name, w.Code)
+		}
+	}
+
+	// empty multipart upload
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField(ParamOperationType, OperationTypeExportTransactions)
+	_ = mw.Close()
+
+	req := httptest.NewRequest("POST", "/export", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	_, _, w := serveExport(t, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status: %d", w.Code)
+	}
+}
@@ -4,21 +4,41 @@
 
 package be2bill
 
+import (
+	"log/slog"
+)
+
 // A FormClient builds various forms to be embedded on a merchant website
 // to use Be2bill to process payments or authorizations.
 type FormClient struct {
 	credentials *Credentials
 	renderer    Renderer
 	hasher      Hasher
+	// Signer, if not nil, signs the forms and verifies the returning
+	// customers instead of the password of the credentials.
+	Signer *Signer
+	// Logger, if not nil, logs every built form and every verified
+	// return, with the card data masked.
+	Logger *slog.Logger
+	// LogLevels, if not nil, defines the levels of the logged messages.
+	// By default, DefaultLogLevels are used.
+	LogLevels *LogLevels
 }
 
 // NewFormClient returns a new FormClient using the given credentials.
 func NewFormClient(credentials *Credentials) *FormClient {
 	return &FormClient{
-		credentials,
-		newHTMLRenderer(credentials.environment[0]),
-		&defaultHasher{},
+		credentials: credentials,
+		renderer:    newHTMLRenderer(credentials.environment[0]),
+		hasher:      &defaultHasher{},
+	}
+}
+
+func (p *FormClient) signer() *Signer {
+	if p.Signer != nil {
+		return p.Signer
 	}
+	return newPasswordSigner(p.hasher, p.credentials.password)
 }
 
 // BuildPaymentFormButton returns a payment form ready to be embedded on
@@ -78,7 +98,8 @@ func (p *FormClient) buildProcessButton(operationType, orderID, clientID, descri
 	options[ParamDescription] = description
 	options[ParamVersion] = APIVersion
 
-	options[ParamHash] = p.hasher.ComputeHash(p.credentials.password, options)
+	options[ParamHash] = p.signer().Sign(options)
+	p.logForm(options)
 
 	return p.renderer.Render(options, htmlOptions)
 }
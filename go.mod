@@ -0,0 +1,3 @@
+module github.com/noirotm/go-be2bill
+
+go 1.21
@@ -8,6 +8,9 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
+	"sort"
 )
 
 // A Hasher is used to sign a request to the API.
@@ -21,39 +24,166 @@ import (
 // of the parameters will render the request invalid.
 //
 // The default Be2bill hasher uses the SHA-256 algorithm.
+// Hashers using another hash function can be created with NewHasher.
 type Hasher interface {
 	// ComputeHash returns a hash string computed from the given password and options.
 	ComputeHash(password string, options Options) string
 }
 
-type defaultHasher struct{}
+// A HashFunc returns a new hash.Hash used to hash the clear string built
+// from the parameters of a request and the given password.
+//
+// The password is already part of the clear string, but it can also be
+// used as a key, for example by an HMAC variant:
+//
+//	func(password string) hash.Hash {
+//		return hmac.New(sha256.New, []byte(password))
+//	}
+type HashFunc func(password string) hash.Hash
 
-func (defaultHasher) ComputeHash(password string, params Options) string {
-	var clearString bytes.Buffer
-	_, _ = clearString.WriteString(password)
+// SHA256 is the HashFunc used by the default hasher.
+func SHA256(password string) hash.Hash {
+	return sha256.New()
+}
 
-	for _, k := range params.sortedKeys() {
-		value := params[k]
-		if k == ParamHash {
-			continue
-		}
+type defaultHasher struct {
+	hash HashFunc
+}
+
+// DefaultHasher returns the Hasher used by the clients and handlers of this
+// package, which uses the SHA-256 algorithm.
+func DefaultHasher() Hasher {
+	return &defaultHasher{}
+}
+
+// NewHasher returns a Hasher that builds the clear string of the parameters
+// as the default hasher does, and hashes it using the given function.
+func NewHasher(f HashFunc) Hasher {
+	return &defaultHasher{f}
+}
+
+func (p defaultHasher) ComputeHash(password string, params Options) string {
+	f := p.hash
+	if f == nil {
+		f = SHA256
+	}
+
+	h := f(password)
+	_, _ = io.WriteString(h, password)
+
+	for _, param := range hashedParameters(params) {
+		_, _ = io.WriteString(h, param.String())
+		_, _ = io.WriteString(h, password)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// hashedParameters returns the parameters hashed by the default hasher,
+// in the order they are hashed.
+func hashedParameters(params Options) []Parameter {
+	hashed := params
+	if _, ok := params[ParamHash]; ok {
+		hashed = params.copy()
+		delete(hashed, ParamHash)
+	}
+	return hashed.parameters()
+}
 
-		if valueMap, ok := value.(Options); ok {
-			for _, vk := range valueMap.sortedKeys() {
-				_, _ = clearString.WriteString(fmt.Sprintf("%s[%s]=%v%s", k, vk, valueMap[vk], password))
-			}
-		} else {
-			_, _ = clearString.WriteString(fmt.Sprintf("%s=%v%s", k, value, password))
+// redactedPassword replaces the password in the clear strings returned
+// by HashExplanation.String.
+const redactedPassword = "<PASSWORD>"
+
+// A HashExplanation is the canonical ordered list of parameters hashed
+// by the default hasher.
+type HashExplanation []Parameter
+
+// ExplainHash returns the parameters that the default hasher hashes for
+// the given options, in the order they are hashed.
+//
+// It is meant to diagnose requests rejected with ExecCodeInvalidHash:
+// the clear string hashed is the account password followed by each
+// parameter, each of them followed by the password again.
+func ExplainHash(params Options) HashExplanation {
+	return hashedParameters(params)
+}
+
+// String returns the clear string hashed by the default hasher,
+// with the password redacted.
+func (p HashExplanation) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString(redactedPassword)
+	for _, param := range p {
+		_, _ = buf.WriteString(param.String())
+		_, _ = buf.WriteString(redactedPassword)
+	}
+	return buf.String()
+}
+
+// A HashMismatch describes a parameter that is hashed differently in two
+// sets of parameters.
+type HashMismatch struct {
+	// Name is the name of the parameter, as in Parameter.
+	Name string
+	// Expected and Received are the hashed values of the parameter.
+	Expected string
+	Received string
+	// Missing is true if the parameter is not hashed in the received
+	// parameters, and Unexpected if it is not hashed in the expected ones.
+	Missing    bool
+	Unexpected bool
+}
+
+func (p HashMismatch) String() string {
+	switch {
+	case p.Missing:
+		return fmt.Sprintf("%s: missing, expected %q", p.Name, p.Expected)
+	case p.Unexpected:
+		return fmt.Sprintf("%s: unexpected %q", p.Name, p.Received)
+	}
+	return fmt.Sprintf("%s: expected %q, received %q", p.Name, p.Expected, p.Received)
+}
+
+// DiffHash compares the parameters hashed by the default hasher for
+// the expected and received options, and returns the parameters that
+// differ, sorted by name. The HASH parameters are ignored.
+//
+// The received options can be those of a notification or of a return
+// request whose hash does not match, and the expected options those that
+// were sent to the be2bill servers, which reveals values whose formatting
+// has changed, such as amounts or nested AMOUNTS keys.
+// An empty result means both options have the same hash.
+func DiffHash(expected, received Options) []HashMismatch {
+	values := make(map[string]string)
+	for _, param := range hashedParameters(received) {
+		values[param.Name] = param.Value
+	}
+
+	var diff []HashMismatch
+	for _, param := range hashedParameters(expected) {
+		value, ok := values[param.Name]
+		delete(values, param.Name)
+		switch {
+		case !ok:
+			diff = append(diff, HashMismatch{Name: param.Name, Expected: param.Value, Missing: true})
+		case value != param.Value:
+			diff = append(diff, HashMismatch{Name: param.Name, Expected: param.Value, Received: value})
 		}
 	}
+	for name, value := range values {
+		diff = append(diff, HashMismatch{Name: name, Received: value, Unexpected: true})
+	}
 
-	return fmt.Sprintf("%x", sha256.Sum256(clearString.Bytes()))
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Name < diff[j].Name })
+	return diff
 }
 
 // CheckHash extracts a parameter named HASH from the given options,
 // computes a hash using the given hasher for the options and password,
-// and compares the two strings.
+// and compares the two strings in constant time.
 // It then returns true if both strings are identical, false otherwise.
+//
+// Use a Signer to accept several passwords during a password rotation.
 func CheckHash(hasher Hasher, password string, params Options) bool {
 	receivedHash, ok := params[ParamHash].(string)
 	if !ok {
@@ -62,5 +192,5 @@ func CheckHash(hasher Hasher, password string, params Options) bool {
 
 	computedHash := hasher.ComputeHash(password, params)
 
-	return receivedHash == computedHash
+	return equalHashes(receivedHash, computedHash)
 }
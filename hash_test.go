@@ -4,7 +4,12 @@
 
 package be2bill
 
-import "testing"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestSimpleHash(t *testing.T) {
 	opts := Options{"c": 3, "a": "1", "b": "2"}
@@ -115,3 +120,75 @@ func TestHashCheckCapture(t *testing.T) {
 		t.Error("invalid hash")
 	}
 }
+
+func TestExplainHash(t *testing.T) {
+	opts := Options{
+		"c":    3,
+		"a":    "1",
+		"HASH": "shouldnotimpact",
+		"d": Options{
+			"y": 43,
+			"x": 42,
+		},
+	}
+
+	e := ExplainHash(opts)
+	want := []string{"a=1", "c=3", "d[x]=42", "d[y]=43"}
+	if len(e) != len(want) {
+		t.Fatalf("unexpected explanation: %v", e)
+	}
+	for i, param := range e {
+		if param.String() != want[i] {
+			t.Errorf("expected %s, got %s", want[i], param)
+		}
+	}
+
+	if s := e.String(); s != "<PASSWORD>a=1<PASSWORD>c=3<PASSWORD>d[x]=42<PASSWORD>d[y]=43<PASSWORD>" {
+		t.Errorf("unexpected clear string: %s", s)
+	}
+	if strings.Contains(fmt.Sprint(e), "password") {
+		t.Errorf("password not redacted: %v", e)
+	}
+}
+
+func TestDiffHash(t *testing.T) {
+	expected := Options{
+		"AMOUNTS": Options{
+			"2016-05-14": 100,
+			"2016-06-14": 200,
+		},
+		"DESCRIPTION": "desc",
+		"ORDERID":     "order_1",
+		"HASH":        "a",
+	}
+	received := Options{
+		"AMOUNTS": Options{
+			"2016-05-14": "100",
+			"2016-06-15": "200",
+		},
+		"DESCRIPTION": "desc",
+		"ORDERID":     "order_1",
+		"CLIENTIDENT": "ident",
+		"HASH":        "b",
+	}
+
+	diff := DiffHash(expected, received)
+	want := []HashMismatch{
+		{Name: "AMOUNTS[2016-06-14]", Expected: "200", Missing: true},
+		{Name: "AMOUNTS[2016-06-15]", Received: "200", Unexpected: true},
+		{Name: "CLIENTIDENT", Received: "ident", Unexpected: true},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+
+	received = Options{"AMOUNT": "100.00", "HASH": "b"}
+	diff = DiffHash(Options{"AMOUNT": 10000}, received)
+	if len(diff) != 1 || diff[0].String() != `AMOUNT: expected "10000", received "100.00"` {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+
+	if diff := DiffHash(expected, expected.copy()); len(diff) != 0 {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+}
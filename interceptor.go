@@ -0,0 +1,76 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"net/http"
+)
+
+// A Call is a Direct Link request sent to a be2bill server.
+type Call struct {
+	// OperationType is the type of the operation, such as
+	// OperationTypePayment or OperationTypeExportTransactions.
+	OperationType string
+	// URL is the URL the request is sent to.
+	URL string
+	// Params are the signed parameters of the request.
+	// An interceptor modifying them must call Sign afterwards.
+	Params Options
+	// Header contains additional HTTP headers sent with the request.
+	Header http.Header
+
+	signer *Signer
+}
+
+// Sign computes the HASH parameter of the call again, after its parameters
+// have been modified.
+func (p *Call) Sign() {
+	p.Params[ParamHash] = p.signer.Sign(p.Params)
+}
+
+// An Invoker sends a call to a be2bill server and returns its result.
+type Invoker func(ctx context.Context, call *Call) (Result, error)
+
+// An Interceptor is called by a DirectLinkClient for every request sent to
+// a be2bill server, with the next Invoker of the chain.
+//
+// An interceptor can inspect or modify the call before passing it to next,
+// and inspect or replace the result and error it returns, to implement
+// logging, metrics, header injection or fault injection.
+// It can also return without calling next, in which case the request
+// is not sent.
+type Interceptor func(ctx context.Context, call *Call, next Invoker) (Result, error)
+
+// invoke sends the request to the given URL through the interceptors
+// of the client.
+func (p *DirectLinkClient) invoke(ctx context.Context, url string, params Options) (Result, error) {
+	call := &Call{
+		URL:    url,
+		Params: params,
+		Header: make(http.Header),
+		signer: p.signer(),
+	}
+	call.OperationType, _ = params[ParamOperationType].(string)
+
+	if len(p.Interceptors) > 0 {
+		// copy the parameters so modifications do not affect the next attempts
+		call.Params = params.copy()
+	}
+	return p.chain(0)(ctx, call)
+}
+
+// chain returns the Invoker calling the interceptors of the client
+// starting at index i.
+func (p *DirectLinkClient) chain(i int) Invoker {
+	if i == len(p.Interceptors) {
+		return func(ctx context.Context, call *Call) (Result, error) {
+			return p.doPostRequest(ctx, call)
+		}
+	}
+	return func(ctx context.Context, call *Call) (Result, error) {
+		return p.Interceptors[i](ctx, call, p.chain(i+1))
+	}
+}
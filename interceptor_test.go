@@ -0,0 +1,104 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newVerifyingServer returns a server checking the hash of the requests
+// and answering with the order ID and the X-Request-ID header it received.
+func newVerifyingServer(password string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		params := ParseOptions(r.PostForm)["params"].(Options)
+		code := ExecCodeSuccess
+		if !CheckHash(&defaultHasher{}, password, params) {
+			code = ExecCodeInvalidHash
+		}
+		fmt.Fprintf(w, `{"OPERATIONTYPE":%q,"EXECCODE":%q,"ORDERID":%q,"REQUESTID":%q}`,
+			params[ParamOperationType], code, params[ParamOrderID], r.Header.Get("X-Request-ID"))
+	}))
+}
+
+func TestInterceptors(t *testing.T) {
+	ts := newVerifyingServer("bar")
+	defer ts.Close()
+
+	var trace []string
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+	c.Interceptors = []Interceptor{
+		func(ctx context.Context, call *Call, next Invoker) (Result, error) {
+			trace = append(trace, "first "+call.OperationType)
+			call.Header.Set("X-Request-ID", "42")
+			result, err := next(ctx, call)
+			trace = append(trace, "first "+string(result.ExecCode()))
+			return result, err
+		},
+		func(ctx context.Context, call *Call, next Invoker) (Result, error) {
+			trace = append(trace, "second "+strings.TrimPrefix(call.URL, ts.URL))
+			call.Params[ParamOrderID] = "order_2"
+			call.Sign()
+			return next(ctx, call)
+		},
+	}
+
+	r, err := c.Capture("A1", "order_1", "desc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success() || r.OrderID() != "order_2" || r.StringValue("REQUESTID") != "42" {
+		t.Errorf("unexpected result: %v", r)
+	}
+	expected := []string{"first capture", "second " + directLinkPath, "first 0000"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Errorf("unexpected trace: %v", trace)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"OPERATIONTYPE":"capture","EXECCODE":"0000"}`)
+	}))
+	defer ts.Close()
+
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+	c.Interceptors = []Interceptor{
+		func(ctx context.Context, call *Call, next Invoker) (Result, error) {
+			return Result{ResultParamExecCode: string(ExecCodeCardRefused)}, nil
+		},
+	}
+	r, err := c.Capture("A1", "order_1", "desc", nil)
+	if err != nil || r.ExecCode() != ExecCodeCardRefused || requests != 0 {
+		t.Errorf("unexpected result: %v, %v, %d requests", r, err, requests)
+	}
+
+	// fault injection on the first server triggers the failover
+	ts2 := newVerifyingServer("bar")
+	defer ts2.Close()
+	faultErr := errors.New("injected fault")
+	c = NewDirectLinkClient(User("foo", "bar", Environment{ts.URL, ts2.URL}))
+	c.Interceptors = []Interceptor{
+		func(ctx context.Context, call *Call, next Invoker) (Result, error) {
+			if strings.HasPrefix(call.URL, ts.URL) {
+				return nil, faultErr
+			}
+			return next(ctx, call)
+		},
+	}
+	r, err = c.Capture("A1", "order_1", "desc", nil)
+	if err != nil || !r.Success() || requests != 0 {
+		t.Errorf("unexpected result: %v, %v, %d requests", r, err, requests)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// LogLevels are the levels of the messages logged by the clients.
+type LogLevels struct {
+	// Request is the level of the message logged for every request sent
+	// to a server, including retries and failover requests.
+	Request slog.Level
+	// Operation is the level of the message logged when an operation
+	// completes, or when a form is built or a return is verified.
+	Operation slog.Level
+	// Failure is the level of the messages logged when a request fails
+	// and the next URL is tried, and when an operation fails.
+	Failure slog.Level
+}
+
+// DefaultLogLevels are the levels used by the clients whose LogLevels
+// field is nil.
+var DefaultLogLevels = LogLevels{
+	Request:   slog.LevelDebug,
+	Operation: slog.LevelInfo,
+	Failure:   slog.LevelWarn,
+}
+
+// clientLogger logs the messages of a client, masking the card data
+// of the parameters and results.
+type clientLogger struct {
+	logger *slog.Logger
+	LogLevels
+}
+
+func newClientLogger(logger *slog.Logger, levels *LogLevels) clientLogger {
+	if levels == nil {
+		levels = &DefaultLogLevels
+	}
+	return clientLogger{logger, *levels}
+}
+
+// enabled returns true if a message is logged at the given level.
+func (p clientLogger) enabled(ctx context.Context, level slog.Level) bool {
+	return p.logger != nil && p.logger.Enabled(ctx, level)
+}
+
+func (p clientLogger) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if p.enabled(ctx, level) {
+		p.logger.LogAttrs(ctx, level, msg, attrs...)
+	}
+}
+
+// operationAttrs returns the attributes identifying the operation
+// of the given parameters.
+func operationAttrs(params Options) []slog.Attr {
+	attrs := make([]slog.Attr, 0, 8)
+	if v, ok := params[ParamOperationType].(string); ok {
+		attrs = append(attrs, slog.String("operation", v))
+	}
+	if v, ok := params[ParamOrderID].(string); ok {
+		attrs = append(attrs, slog.String("order_id", v))
+	}
+	return attrs
+}
+
+// resultAttrs appends the attributes describing the outcome of a request
+// or an operation to attrs.
+func resultAttrs(attrs []slog.Attr, result Result, err error) []slog.Attr {
+	if result != nil {
+		attrs = append(attrs, slog.String("exec_code", string(result.ExecCode())))
+		if id := result.TransactionID(); id != "" {
+			attrs = append(attrs, slog.String("transaction_id", id))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	return attrs
+}
+
+// logRequest logs a request sent to a server, with its HTTP status if
+// the server answered.
+func (p *DirectLinkClient) logRequest(ctx context.Context, call *Call, status int, result Result, err error, d time.Duration) {
+	l := p.log()
+	if !l.enabled(ctx, l.Request) {
+		return
+	}
+
+	attrs := append(operationAttrs(call.Params), slog.String("url", call.URL))
+	if status != 0 {
+		attrs = append(attrs, slog.Int("status", status))
+	}
+	attrs = append(attrs, slog.Duration("duration", d))
+	attrs = resultAttrs(attrs, result, err)
+	attrs = append(attrs, slog.Any("params", call.Params))
+	l.log(ctx, l.Request, "be2bill request", attrs...)
+}
+
+// logFailover logs a request that failed before trying the next URL.
+func (p *DirectLinkClient) logFailover(ctx context.Context, params Options, url, next string, err error) {
+	l := p.log()
+	if !l.enabled(ctx, l.Failure) {
+		return
+	}
+
+	attrs := append(operationAttrs(params),
+		slog.String("url", url),
+		slog.String("next_url", next),
+		slog.String("error", err.Error()),
+	)
+	l.log(ctx, l.Failure, "be2bill failover", attrs...)
+}
+
+// logOperation logs the outcome of an operation, after all its attempts.
+func (p *DirectLinkClient) logOperation(ctx context.Context, params Options, attempts int, result Result, err error, d time.Duration) {
+	l := p.log()
+	level := l.Operation
+	if err != nil || isFailure(result) {
+		level = l.Failure
+	}
+	if !l.enabled(ctx, level) {
+		return
+	}
+
+	attrs := append(operationAttrs(params), slog.Duration("duration", d))
+	if attempts > 1 {
+		attrs = append(attrs, slog.Int("attempts", attempts))
+	}
+	attrs = resultAttrs(attrs, result, err)
+	l.log(ctx, level, "be2bill operation", attrs...)
+}
+
+func (p *FormClient) log() clientLogger {
+	return newClientLogger(p.Logger, p.LogLevels)
+}
+
+// logForm logs a built form.
+func (p *FormClient) logForm(params Options) {
+	ctx := context.Background()
+	l := p.log()
+	if l.enabled(ctx, l.Operation) {
+		l.log(ctx, l.Operation, "be2bill form", operationAttrs(params)...)
+	}
+}
+
+// logReturn logs the outcome of the verification of a returning customer.
+func (p *FormClient) logReturn(ctx context.Context, result Result, err error) {
+	l := p.log()
+	level := l.Operation
+	if err != nil || isFailure(result) {
+		level = l.Failure
+	}
+	if l.enabled(ctx, level) {
+		l.log(ctx, level, "be2bill return", resultAttrs(operationAttrs(Options(result)), result, err)...)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// logEntries returns the messages logged as JSON in buf.
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %s: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestDirectLinkClientLogger(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"OPERATIONTYPE":"payment","EXECCODE":"0000","TRANSACTIONID":"A1","ORDERID":"order_1"}`)
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	c := NewDirectLinkClient(User("foo", "bar", Environment{failing.URL, ts.URL}))
+	c.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	if _, err := directLinkMethods["Payment"](c); err != nil {
+		t.Fatal(err)
+	}
+	if leaksCardData(buf.String()) {
+		t.Errorf("card data logged: %s", buf.String())
+	}
+
+	entries := logEntries(t, &buf)
+	expected := []struct {
+		msg, level, url string
+		status          float64
+	}{
+		{"be2bill request", "DEBUG", failing.URL, 500},
+		{"be2bill failover", "WARN", failing.URL, 0},
+		{"be2bill request", "DEBUG", ts.URL, 200},
+		{"be2bill operation", "INFO", "", 0},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+	for i, e := range expected {
+		entry := entries[i]
+		if entry["msg"] != e.msg || entry["level"] != e.level {
+			t.Errorf("%d: unexpected entry %v", i, entry)
+		}
+		if entry["operation"] != OperationTypePayment || entry["order_id"] != "order_1" {
+			t.Errorf("%d: missing operation: %v", i, entry)
+		}
+		if e.url != "" && entry["url"] != e.url+directLinkPath {
+			t.Errorf("%d: unexpected url: %v", i, entry)
+		}
+		if e.status != 0 && entry["status"] != e.status {
+			t.Errorf("%d: unexpected status: %v", i, entry)
+		}
+	}
+	if entries[1]["next_url"] != ts.URL+directLinkPath || entries[1]["error"] != ErrServerError.Error() {
+		t.Errorf("unexpected failover: %v", entries[1])
+	}
+	if entries[3]["exec_code"] != string(ExecCodeSuccess) || entries[3]["transaction_id"] != "A1" {
+		t.Errorf("unexpected operation: %v", entries[3])
+	}
+	if _, ok := entries[3]["duration"]; !ok {
+		t.Errorf("missing duration: %v", entries[3])
+	}
+}
+
+func TestDirectLinkClientLogLevels(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"OPERATIONTYPE":"capture","EXECCODE":"4001"}`)
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+	c.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	c.LogLevels = &LogLevels{
+		Request:   slog.LevelInfo,
+		Operation: slog.LevelDebug,
+		Failure:   slog.LevelError,
+	}
+
+	if _, err := c.Capture("A1", "order_1", "desc", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logEntries(t, &buf)
+	if len(entries) != 2 ||
+		entries[0]["msg"] != "be2bill request" || entries[0]["level"] != "INFO" ||
+		entries[1]["msg"] != "be2bill operation" || entries[1]["level"] != "ERROR" ||
+		entries[1]["exec_code"] != "4001" {
+		t.Errorf("unexpected log: %s", buf.String())
+	}
+}
+
+func TestFormClientLogger(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewFormClient(User("foo", "bar", EnvSandbox))
+	c.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	c.BuildPaymentFormButton(SingleAmount(100), "order_1", "ident", "desc", nil,
+		Options{ParamCardCode: testPAN})
+	if leaksCardData(buf.String()) {
+		t.Errorf("card data logged: %s", buf.String())
+	}
+
+	entries := logEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["msg"] != "be2bill form" ||
+		entries[0]["operation"] != OperationTypePayment || entries[0]["order_id"] != "order_1" {
+		t.Errorf("unexpected log: %s", buf.String())
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+var (
+	// digitsPattern matches the sequences of digits that may be card numbers.
+	digitsPattern = regexp.MustCompile(`\d+`)
+	// cvvPattern matches a cryptogram following its parameter name, in
+	// a JSON document, a form-encoded body or a Go representation.
+	cvvPattern = regexp.MustCompile(`(?i)(CARDCVV(?:%[0-9a-f]{2}|[^0-9a-z]){0,12})\d{3,4}`)
+)
+
+// MaskCardCode returns the given card number with every digit but the first
+// six and the last four replaced by X, as allowed by PCI DSS.
+// Numbers too short to be card numbers are fully masked.
+func MaskCardCode(pan string) string {
+	if len(pan) < 13 {
+		return strings.Repeat("X", len(pan))
+	}
+	return pan[:6] + strings.Repeat("X", len(pan)-10) + pan[len(pan)-4:]
+}
+
+// isCardNumber returns true if the given digits have the length of a card
+// number and a valid Luhn checksum.
+func isCardNumber(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// MaskCardData masks the card numbers found in the given text as described
+// in MaskCardCode, and the cryptograms following a CARDCVV parameter name.
+// The text may come from a server response or from an error.
+func MaskCardData(s string) string {
+	s = digitsPattern.ReplaceAllStringFunc(s, func(digits string) string {
+		if isCardNumber(digits) {
+			return MaskCardCode(digits)
+		}
+		return digits
+	})
+	return cvvPattern.ReplaceAllString(s, "${1}XXX")
+}
+
+// Masked returns a copy of the options that is safe to log or to display:
+// the card number is masked except for its first six and last four digits,
+// the cryptogram is removed, and the hash is redacted.
+// Card numbers found in the other values, such as an echoed request in
+// a message, are masked as well, and so are nested options.
+func (p Options) Masked() Options {
+	masked := make(Options, len(p))
+	for k, v := range p {
+		switch k {
+		case ParamCardCVV:
+			continue
+		case ParamCardCode:
+			masked[k] = MaskCardCode(fmt.Sprint(v))
+		case ParamHash:
+			masked[k] = redacted
+		default:
+			switch value := v.(type) {
+			case Options:
+				masked[k] = value.Masked()
+			case map[string]interface{}:
+				masked[k] = Options(value).Masked()
+			case string:
+				masked[k] = MaskCardData(value)
+			default:
+				masked[k] = v
+			}
+		}
+	}
+	return masked
+}
+
+// LogValue implements slog.LogValuer, and logs the masked options as a group.
+func (p Options) LogValue() slog.Value {
+	masked := p.Masked()
+	attrs := make([]slog.Attr, 0, len(masked))
+	for _, k := range masked.sortedKeys() {
+		attrs = append(attrs, slog.Any(k, masked[k]))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Masked returns a copy of the result that is safe to log or to display,
+// as described in Options.Masked.
+func (r Result) Masked() Result {
+	return Result(Options(r).Masked())
+}
+
+// LogValue implements slog.LogValuer, and logs the masked result as a group.
+func (r Result) LogValue() slog.Value {
+	return Options(r).LogValue()
+}
@@ -0,0 +1,309 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const (
+	testPAN = "4111111111111111"
+	testCVV = "987"
+)
+
+func TestOptionsMasked(t *testing.T) {
+	o := Options{
+		ParamCardCode:         testPAN,
+		ParamCardCVV:          testCVV,
+		ParamCardValidityDate: "12-20",
+		ParamHash:             "abcdef",
+		ParamOrderID:          "order_1",
+		"params": Options{
+			ParamCardCode: testPAN,
+			ParamCardCVV:  testCVV,
+		},
+	}
+
+	m := o.Masked()
+	expected := Options{
+		ParamCardCode:         "411111XXXXXX1111",
+		ParamCardValidityDate: "12-20",
+		ParamHash:             "REDACTED",
+		ParamOrderID:          "order_1",
+		"params": Options{
+			ParamCardCode: "411111XXXXXX1111",
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("unexpected masked options: %v", m)
+	}
+	if o[ParamCardCode] != testPAN || o[ParamCardCVV] != testCVV {
+		t.Error("original options modified")
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("request", "params", o, "result", Result{ParamCardCode: testPAN, ResultParamExecCode: "0000"})
+	for _, s := range []string{testPAN, testCVV, "abcdef"} {
+		if strings.Contains(buf.String(), s) {
+			t.Errorf("log contains %q: %s", s, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), `"params":{"CARDCODE":"411111XXXXXX1111"}`) {
+		t.Errorf("unexpected log: %s", buf.String())
+	}
+}
+
+func TestMaskCardData(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"card 4111111111111111 refused", "card 411111XXXXXX1111 refused"},
+		{"params%5BCARDCODE%5D=5555555555554444&params%5BCARDCVV%5D=987", "params%5BCARDCODE%5D=555555XXXXXX4444&params%5BCARDCVV%5D=XXX"},
+		{`{"CARDCVV":"1234","ORDERID":"1423675675000"}`, `{"CARDCVV":"XXX","ORDERID":"1423675675000"}`},
+		{"order 1423675675 of 12-20", "order 1423675675 of 12-20"},
+	}
+	for _, tc := range testCases {
+		if s := MaskCardData(tc.s); s != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, s)
+		}
+	}
+}
+
+// cvvLeak matches the test cryptogram following its parameter name.
+var cvvLeak = regexp.MustCompile(`(?i)cardcvv(?:%[0-9a-f]{2}|[^0-9a-z])*` + testCVV)
+
+// leaksCardData returns true if the given text contains the test card
+// number or cryptogram.
+func leaksCardData(s string) bool {
+	return strings.Contains(s, testPAN) || cvvLeak.MatchString(s)
+}
+
+// directLinkMethods calls every method of a DirectLinkClient with
+// the test card data, either as a card or as additional options.
+var directLinkMethods = map[string]func(c *DirectLinkClient) (Result, error){}
+
+func init() {
+	ctx := context.Background()
+	card := Card{testPAN, "12-30", testCVV, "john doe"}
+	order := Order{"order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox"}
+	opts := func() Options {
+		return Options{ParamCardCode: testPAN, ParamCardCVV: testCVV}
+	}
+	ids := []string{"A1"}
+	m := directLinkMethods
+
+	m["Payment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.Payment(testPAN, "12-30", testCVV, "john doe", SingleAmount(100), "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", nil)
+	}
+	m["PaymentContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.PaymentContext(ctx, testPAN, "12-30", testCVV, "john doe", SingleAmount(100), "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", nil)
+	}
+	m["Authorization"] = func(c *DirectLinkClient) (Result, error) {
+		return c.Authorization(testPAN, "12-30", testCVV, "john doe", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", nil)
+	}
+	m["AuthorizationContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.AuthorizationContext(ctx, testPAN, "12-30", testCVV, "john doe", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", nil)
+	}
+	m["Credit"] = func(c *DirectLinkClient) (Result, error) {
+		return c.Credit(testPAN, "12-30", testCVV, "john doe", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", nil)
+	}
+	m["CreditContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.CreditContext(ctx, testPAN, "12-30", testCVV, "john doe", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", nil)
+	}
+	m["OneClickPayment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.OneClickPayment("A1", SingleAmount(100), "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["OneClickPaymentContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.OneClickPaymentContext(ctx, "A1", SingleAmount(100), "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["OneClickAuthorization"] = func(c *DirectLinkClient) (Result, error) {
+		return c.OneClickAuthorization("A1", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["OneClickAuthorizationContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.OneClickAuthorizationContext(ctx, "A1", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["SubscriptionPayment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.SubscriptionPayment("A1", SingleAmount(100), "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["SubscriptionPaymentContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.SubscriptionPaymentContext(ctx, "A1", SingleAmount(100), "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["SubscriptionAuthorization"] = func(c *DirectLinkClient) (Result, error) {
+		return c.SubscriptionAuthorization("A1", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["SubscriptionAuthorizationContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.SubscriptionAuthorizationContext(ctx, "A1", 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["RedirectForPayment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.RedirectForPayment(100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["RedirectForPaymentContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.RedirectForPaymentContext(ctx, 100, "order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox", opts())
+	}
+	m["Refund"] = func(c *DirectLinkClient) (Result, error) {
+		return c.Refund("A1", "order_1", "desc", opts())
+	}
+	m["RefundContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.RefundContext(ctx, "A1", "order_1", "desc", opts())
+	}
+	m["Capture"] = func(c *DirectLinkClient) (Result, error) {
+		return c.Capture("A1", "order_1", "desc", opts())
+	}
+	m["CaptureContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.CaptureContext(ctx, "A1", "order_1", "desc", opts())
+	}
+	m["StopNTimes"] = func(c *DirectLinkClient) (Result, error) {
+		return c.StopNTimes("S1", opts())
+	}
+	m["StopNTimesContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.StopNTimesContext(ctx, "S1", opts())
+	}
+	m["GetTransactionsByTransactionID"] = func(c *DirectLinkClient) (Result, error) {
+		return c.GetTransactionsByTransactionID(ids, testPAN+"@example.org", CompressionGzip)
+	}
+	m["GetTransactionsByTransactionIDContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.GetTransactionsByTransactionIDContext(ctx, ids, testPAN+"@example.org", CompressionGzip)
+	}
+	m["GetTransactionsByOrderID"] = func(c *DirectLinkClient) (Result, error) {
+		return c.GetTransactionsByOrderID(ids, testPAN+"@example.org", CompressionGzip)
+	}
+	m["GetTransactionsByOrderIDContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.GetTransactionsByOrderIDContext(ctx, ids, testPAN+"@example.org", CompressionGzip)
+	}
+	m["ExportTransactions"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportTransactions("2016-05", "", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ExportTransactionsContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportTransactionsContext(ctx, "2016-05", "", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ExportChargebacks"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportChargebacks("2016-05", "", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ExportChargebacksContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportChargebacksContext(ctx, "2016-05", "", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ExportReconciliation"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportReconciliation("2016-05", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ExportReconciliationContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportReconciliationContext(ctx, "2016-05", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ExportReconciledTransactions"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportReconciledTransactions("2016-05", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ExportReconciledTransactionsContext"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ExportReconciledTransactionsContext(ctx, "2016-05", "exports@example.org", CompressionGzip, opts())
+	}
+	m["ProcessPayment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessPayment(ctx, &PaymentRequest{card, SingleAmount(100), order, nil})
+	}
+	m["ProcessAuthorization"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessAuthorization(ctx, &AuthorizationRequest{card, 100, order, nil})
+	}
+	m["ProcessCredit"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessCredit(ctx, &CreditRequest{card, 100, order, nil})
+	}
+	m["ProcessOneClickPayment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessOneClickPayment(ctx, &AliasPaymentRequest{"A1", SingleAmount(100), order, opts()})
+	}
+	m["ProcessSubscriptionPayment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessSubscriptionPayment(ctx, &AliasPaymentRequest{"A1", SingleAmount(100), order, opts()})
+	}
+	m["ProcessOneClickAuthorization"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessOneClickAuthorization(ctx, &AliasAuthorizationRequest{"A1", 100, order, opts()})
+	}
+	m["ProcessSubscriptionAuthorization"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessSubscriptionAuthorization(ctx, &AliasAuthorizationRequest{"A1", 100, order, opts()})
+	}
+	m["ProcessRedirectForPayment"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessRedirectForPayment(ctx, &RedirectForPaymentRequest{100, order, opts()})
+	}
+	m["ProcessCapture"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessCapture(ctx, &CaptureRequest{"A1", "order_1", "desc", opts()})
+	}
+	m["ProcessRefund"] = func(c *DirectLinkClient) (Result, error) {
+		return c.ProcessRefund(ctx, &RefundRequest{"A1", "order_1", "desc", opts()})
+	}
+}
+
+func TestDirectLinkErrorsMaskCardData(t *testing.T) {
+	// every operation of the client must be tested
+	typ := reflect.TypeOf(&DirectLinkClient{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		if _, ok := directLinkMethods[typ.Method(i).Name]; !ok {
+			t.Errorf("method %s is not tested", typ.Method(i).Name)
+		}
+	}
+
+	// the servers echo the request they receive
+	failure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		http.Error(w, string(body), http.StatusInternalServerError)
+	}))
+	defer failure.Close()
+	refused := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		params := ParseOptions(r.PostForm)["params"].(Options)
+		params[ResultParamExecCode] = ExecCodeCardRefused
+		params[ResultParamMessage] = fmt.Sprintf("card %s refused: %s", testPAN, r.PostForm.Encode())
+		params[ParamCardCode] = testPAN
+		params[ParamCardCVV] = testCVV
+		_ = json.NewEncoder(w).Encode(params)
+	}))
+	defer refused.Close()
+
+	for name, method := range directLinkMethods {
+		for _, url := range []string{failure.URL, refused.URL} {
+			c := NewDirectLinkClient(User("foo", "bar", Environment{url}))
+			c.StrictErrors = true
+
+			_, err := method(c)
+			if err == nil {
+				t.Errorf("%s: expected an error", name)
+				continue
+			}
+			for _, format := range []string{"%v", "%+v", "%#v"} {
+				if s := fmt.Sprintf(format, err); leaksCardData(s) {
+					t.Errorf("%s: error contains card data: %s", name, s)
+				}
+			}
+		}
+	}
+
+	// validation errors
+	for _, name := range []string{"ProcessPayment", "ProcessAuthorization", "ProcessCredit"} {
+		c := NewDirectLinkClient(User("foo", "bar", Environment{failure.URL}))
+		card := Card{testPAN + "A", "12-30", testCVV + "A", "john doe"}
+		order := Order{"order_1", "ident", "test@test.com", "1.1.1.1", "desc", "Firefox"}
+		var err error
+		switch name {
+		case "ProcessPayment":
+			_, err = c.ProcessPayment(context.Background(), &PaymentRequest{card, SingleAmount(100), order, nil})
+		case "ProcessAuthorization":
+			_, err = c.ProcessAuthorization(context.Background(), &AuthorizationRequest{card, 100, order, nil})
+		case "ProcessCredit":
+			_, err = c.ProcessCredit(context.Background(), &CreditRequest{card, 100, order, nil})
+		}
+		if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if s := fmt.Sprintf("%#v", err); strings.Contains(s, testPAN) || strings.Contains(s, testCVV) {
+			t.Errorf("%s: error contains card data: %s", name, s)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"bytes"
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CategoryError is the category given to Metrics for the requests that
+// failed without returning an execution code, such as timeouts or
+// server errors.
+const CategoryError = "error"
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets
+// of the latency histograms of ExpvarMetrics.
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics records measurements of the requests sent by a DirectLinkClient,
+// for example to build dashboards of the latency and decline rates of
+// each operation.
+//
+// The operation type is the OPERATIONTYPE parameter of the request, and
+// the URL is the one the request is sent to.
+// The methods are called concurrently by the operations of the client.
+type Metrics interface {
+	// ObserveRequest records a request sent to a server, with the name of
+	// the category of the returned execution code, or CategoryError,
+	// and the latency of the request.
+	ObserveRequest(operationType, url, category string, latency time.Duration)
+	// IncFailover records a failed request after which the next URL
+	// is tried.
+	IncFailover(operationType, url string)
+	// IncTimeout records a request that timed out.
+	IncTimeout(operationType, url string)
+	// IncHashError records a request rejected because of an invalid hash.
+	IncHashError(operationType, url string)
+}
+
+// observeRequest records a request sent to a server in the metrics
+// of the client.
+func (p *DirectLinkClient) observeRequest(call *Call, result Result, err error, latency time.Duration) {
+	if p.Metrics == nil {
+		return
+	}
+
+	category := CategoryError
+	if err == nil {
+		category = result.ExecCode().Category().String()
+	}
+	p.Metrics.ObserveRequest(call.OperationType, call.URL, category, latency)
+
+	if err == ErrTimeout {
+		p.Metrics.IncTimeout(call.OperationType, call.URL)
+	}
+	if result.ExecCode() == ExecCodeInvalidHash {
+		p.Metrics.IncHashError(call.OperationType, call.URL)
+	}
+}
+
+// observeFailover records a failover in the metrics of the client.
+func (p *DirectLinkClient) observeFailover(params Options, url string) {
+	if p.Metrics != nil {
+		operationType, _ := params[ParamOperationType].(string)
+		p.Metrics.IncFailover(operationType, url)
+	}
+}
+
+// ExpvarMetrics is a Metrics publishing its measurements as a map of
+// expvar variables, served as JSON by the /debug/vars handler of expvar.
+//
+// The map holds the following variables, keyed by operation type then URL:
+//
+//	requests         number of requests by execution code category
+//	latency_seconds  histogram of the latency of the requests
+//	failovers        number of failovers
+//	timeouts         number of timeouts
+//	hash_errors      number of requests rejected because of an invalid hash
+type ExpvarMetrics struct {
+	mu         sync.Mutex
+	vars       *expvar.Map
+	requests   *expvar.Map
+	latency    *expvar.Map
+	failovers  *expvar.Map
+	timeouts   *expvar.Map
+	hashErrors *expvar.Map
+	buckets    []float64
+}
+
+// NewExpvarMetrics returns a new ExpvarMetrics published with the given
+// name, using DefaultLatencyBuckets.
+//
+// Like expvar.Publish, it panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	p := newExpvarMetrics(DefaultLatencyBuckets)
+	expvar.Publish(name, p.vars)
+	return p
+}
+
+func newExpvarMetrics(buckets []float64) *ExpvarMetrics {
+	p := &ExpvarMetrics{
+		vars:       new(expvar.Map),
+		requests:   new(expvar.Map),
+		latency:    new(expvar.Map),
+		failovers:  new(expvar.Map),
+		timeouts:   new(expvar.Map),
+		hashErrors: new(expvar.Map),
+		buckets:    buckets,
+	}
+	p.vars.Set("requests", p.requests)
+	p.vars.Set("latency_seconds", p.latency)
+	p.vars.Set("failovers", p.failovers)
+	p.vars.Set("timeouts", p.timeouts)
+	p.vars.Set("hash_errors", p.hashErrors)
+	return p
+}
+
+// Vars returns the map holding the variables of the metrics.
+func (p *ExpvarMetrics) Vars() *expvar.Map {
+	return p.vars
+}
+
+// ObserveRequest records a request sent to a server.
+func (p *ExpvarMetrics) ObserveRequest(operationType, url, category string, latency time.Duration) {
+	p.subMap(p.subMap(p.requests, operationType), url).Add(category, 1)
+	p.histogram(operationType, url).observe(latency.Seconds())
+}
+
+// IncFailover records a failover.
+func (p *ExpvarMetrics) IncFailover(operationType, url string) {
+	p.subMap(p.failovers, operationType).Add(url, 1)
+}
+
+// IncTimeout records a timeout.
+func (p *ExpvarMetrics) IncTimeout(operationType, url string) {
+	p.subMap(p.timeouts, operationType).Add(url, 1)
+}
+
+// IncHashError records a request rejected because of an invalid hash.
+func (p *ExpvarMetrics) IncHashError(operationType, url string) {
+	p.subMap(p.hashErrors, operationType).Add(url, 1)
+}
+
+// subMap returns the map stored in m with the given key, creating it
+// if needed.
+func (p *ExpvarMetrics) subMap(m *expvar.Map, key string) *expvar.Map {
+	if sub, ok := m.Get(key).(*expvar.Map); ok {
+		return sub
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sub, ok := m.Get(key).(*expvar.Map)
+	if !ok {
+		sub = new(expvar.Map)
+		m.Set(key, sub)
+	}
+	return sub
+}
+
+// histogram returns the latency histogram of the given operation type
+// and URL, creating it if needed.
+func (p *ExpvarMetrics) histogram(operationType, url string) *expvarHistogram {
+	latencies := p.subMap(p.latency, operationType)
+	if h, ok := latencies.Get(url).(*expvarHistogram); ok {
+		return h
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := latencies.Get(url).(*expvarHistogram)
+	if !ok {
+		h = newExpvarHistogram(p.buckets)
+		latencies.Set(url, h)
+	}
+	return h
+}
+
+// An expvarHistogram is an expvar.Var counting observations in buckets,
+// with the same cumulative semantics as Prometheus histograms.
+type expvarHistogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newExpvarHistogram(buckets []float64) *expvarHistogram {
+	return &expvarHistogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *expvarHistogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// String returns the histogram as a JSON object, with the cumulative
+// count of each bucket keyed by its upper bound.
+func (h *expvarHistogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"count": `)
+	buf.WriteString(strconv.FormatUint(h.count, 10))
+	buf.WriteString(`, "sum": `)
+	buf.WriteString(strconv.FormatFloat(h.sum, 'g', -1, 64))
+	buf.WriteString(`, "buckets": {`)
+	for i, bound := range h.buckets {
+		buf.WriteString(strconv.Quote(strconv.FormatFloat(bound, 'g', -1, 64)))
+		buf.WriteString(": ")
+		buf.WriteString(strconv.FormatUint(h.counts[i], 10))
+		buf.WriteString(", ")
+	}
+	buf.WriteString(`"+Inf": `)
+	buf.WriteString(strconv.FormatUint(h.count, 10))
+	buf.WriteString("}}")
+	return buf.String()
+}
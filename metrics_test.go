@@ -0,0 +1,92 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpvarMetrics(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := ExecCodeSuccess
+		if r.PostFormValue("params[ORDERID]") == "tampered" {
+			code = ExecCodeInvalidHash
+		}
+		fmt.Fprintf(w, `{"OPERATIONTYPE":"capture","EXECCODE":%q}`, code)
+	}))
+	defer ts.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	m := newExpvarMetrics(DefaultLatencyBuckets)
+	c := NewDirectLinkClient(User("foo", "bar", Environment{failing.URL, ts.URL}))
+	c.Metrics = m
+	if _, err := c.Capture("A1", "order_1", "desc", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Capture("A1", "tampered", "desc", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c = NewDirectLinkClient(User("foo", "bar", Environment{slow.URL}))
+	c.RequestTimeout = 10 * time.Millisecond
+	c.Metrics = m
+	if _, err := c.Capture("A1", "order_1", "desc", nil); err != ErrTimeout {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var vars struct {
+		Requests   map[string]map[string]map[string]int
+		Latency    map[string]map[string]struct{ Count int } `json:"latency_seconds"`
+		Failovers  map[string]map[string]int
+		Timeouts   map[string]map[string]int
+		HashErrors map[string]map[string]int `json:"hash_errors"`
+	}
+	if err := json.Unmarshal([]byte(m.Vars().String()), &vars); err != nil {
+		t.Fatalf("invalid JSON %s: %v", m.Vars().String(), err)
+	}
+
+	failingURL, url, slowURL := failing.URL+directLinkPath, ts.URL+directLinkPath, slow.URL+directLinkPath
+	requests := vars.Requests[OperationTypeCapture]
+	if requests[failingURL][CategoryError] != 2 || requests[url]["success"] != 1 ||
+		requests[url]["request error"] != 1 || requests[slowURL][CategoryError] != 1 {
+		t.Errorf("unexpected requests: %v", vars.Requests)
+	}
+	if vars.Latency[OperationTypeCapture][url].Count != 2 {
+		t.Errorf("unexpected latency: %v", vars.Latency)
+	}
+	if vars.Failovers[OperationTypeCapture][failingURL] != 2 {
+		t.Errorf("unexpected failovers: %v", vars.Failovers)
+	}
+	if vars.Timeouts[OperationTypeCapture][slowURL] != 1 {
+		t.Errorf("unexpected timeouts: %v", vars.Timeouts)
+	}
+	if vars.HashErrors[OperationTypeCapture][url] != 1 {
+		t.Errorf("unexpected hash errors: %v", vars.HashErrors)
+	}
+}
+
+func TestExpvarHistogram(t *testing.T) {
+	h := newExpvarHistogram([]float64{0.1, 1})
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(2)
+
+	expected := `{"count": 3, "sum": 2.55, "buckets": {"0.1": 1, "1": 2, "+Inf": 3}}`
+	if s := h.String(); s != expected {
+		t.Errorf("want %s, got %s", expected, s)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// notificationAcknowledgement is the response body expected by the be2bill
+// servers once a notification has been processed.
+const notificationAcknowledgement = "OK"
+
+var (
+	// ErrMissingHash is returned when a request received from the be2bill
+	// servers or from a customer is not signed.
+	ErrMissingHash = errors.New("missing hash")
+	// ErrInvalidHash is returned when the signature of a request received
+	// from the be2bill servers or from a customer does not match its parameters.
+	ErrInvalidHash = errors.New("invalid hash")
+)
+
+// A RequestError is returned when a request received from the be2bill
+// servers or from a customer cannot be parsed.
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return "malformed request: " + MaskCardData(e.Err.Error())
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// parseSignedRequest extracts the parameters of the given request, from
+// both its query string and its body, and verifies their hash using
+// the signer returned by signerFor.
+func parseSignedRequest(r *http.Request, signerFor func(Options) (*Signer, error)) (Options, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &RequestError{err}
+	}
+
+	params := ParseOptions(r.Form)
+
+	if _, ok := params[ParamHash].(string); !ok {
+		return nil, ErrMissingHash
+	}
+	signer, err := signerFor(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := signer.Verify(params); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+// A NotificationFunc is called by a NotificationHandler for every
+// notification whose signature has been verified.
+// If it returns an error, the notification is not acknowledged and
+// the be2bill servers will send it again later.
+type NotificationFunc func(r *http.Request, result Result) error
+
+// A NotificationHandler is an http.Handler that receives the transaction
+// notifications sent by the be2bill servers after a form payment,
+// a 3-D Secure authentication or a scheduled payment.
+//
+// Each notification is verified using the account password, then
+// passed to the user callback, and finally acknowledged as expected
+// by the platform.
+//
+// Notifications that cannot be parsed are answered with a
+// 400 Bad Request status, notifications with a missing or invalid hash
+// with a 403 Forbidden status, and notifications for which the callback
+// returns an error with a 500 Internal Server Error status.
+type NotificationHandler struct {
+	credentials *Credentials
+	hasher      Hasher
+	registry    *Registry
+	handler     NotificationFunc
+	// ErrorHandler, if not nil, is called with the request and the error
+	// every time a notification is rejected.
+	ErrorHandler func(r *http.Request, err error)
+	// Signer, if not nil, verifies the notifications instead of
+	// the password of the credentials, so that notifications signed with
+	// a previous password are accepted during a password rotation.
+	Signer *Signer
+}
+
+// NewNotificationHandler returns a new NotificationHandler using the given
+// credentials to verify notifications, and calling handler for each of them.
+func NewNotificationHandler(credentials *Credentials, handler NotificationFunc) *NotificationHandler {
+	return &NotificationHandler{
+		credentials: credentials,
+		hasher:      &defaultHasher{},
+		handler:     handler,
+	}
+}
+
+func (p *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSignedRequest(r, p.signerFor)
+	if err != nil {
+		status := http.StatusForbidden
+		if _, ok := err.(*RequestError); ok {
+			status = http.StatusBadRequest
+		}
+		p.fail(w, r, err, status)
+		return
+	}
+
+	if err := p.handler(r, Result(params)); err != nil {
+		p.fail(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, notificationAcknowledgement)
+}
+
+func (p *NotificationHandler) signerFor(params Options) (*Signer, error) {
+	switch {
+	case p.Signer != nil:
+		return p.Signer, nil
+	case p.registry != nil:
+		return p.registry.signerFor(params)
+	}
+	return newPasswordSigner(p.hasher, p.credentials.password), nil
+}
+
+func (p *NotificationHandler) fail(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(r, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
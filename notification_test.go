@@ -0,0 +1,117 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// signedParams returns the parameters of a payment signed with
+// the given password, as sent in notifications and customer returns.
+func signedParams(password string, execCode ExecCode) Options {
+	params := Options{
+		ParamIdentifier:     "foo",
+		ParamOperationType:  OperationTypePayment,
+		ParamTransactionID:  "A151621",
+		ParamOrderID:        "order_1423675675",
+		ParamAmount:         "15235",
+		ParamAlias:          "A151621",
+		ResultParamExecCode: execCode,
+		ResultParamMessage:  "The transaction has been accepted.",
+	}
+	params[ParamHash] = (&defaultHasher{}).ComputeHash(password, params)
+	return params
+}
+
+func postNotification(h http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/notification", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestNotificationHandler(t *testing.T) {
+	var received Result
+	h := NewNotificationHandler(SandboxUser("foo", "bar"), func(r *http.Request, result Result) error {
+		received = result
+		return nil
+	})
+	h.ErrorHandler = func(r *http.Request, err error) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	w := postNotification(h, signedParams("bar", ExecCodeSuccess).urlValues().Encode())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status: %d", w.Code)
+	}
+	if w.Body.String() != "OK" {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+	if received == nil {
+		t.Fatal("callback not called")
+	}
+	if received.TransactionID() != "A151621" {
+		t.Errorf("unexpected transaction ID: %s", received.TransactionID())
+	}
+	if !received.Success() {
+		t.Errorf("exec code %s, message: %s", received.ExecCode(), received.Message())
+	}
+}
+
+func TestNotificationHandlerErrors(t *testing.T) {
+	callbackErr := errors.New("database unavailable")
+
+	tamperedParams := signedParams("bar", ExecCodeSuccess)
+	tamperedParams[ParamAmount] = "1"
+	unsignedParams := signedParams("bar", ExecCodeSuccess)
+	delete(unsignedParams, ParamHash)
+
+	testCases := []struct {
+		name     string
+		body     string
+		callback error
+		status   int
+		err      error
+	}{
+		{"tampered", tamperedParams.urlValues().Encode(), nil, http.StatusForbidden, ErrInvalidHash},
+		{"wrong password", signedParams("baz", ExecCodeSuccess).urlValues().Encode(), nil, http.StatusForbidden, ErrInvalidHash},
+		{"unsigned", unsignedParams.urlValues().Encode(), nil, http.StatusForbidden, ErrMissingHash},
+		{"malformed", "HASH=%zz", nil, http.StatusBadRequest, nil},
+		{"callback", signedParams("bar", ExecCodeSuccess).urlValues().Encode(), callbackErr, http.StatusInternalServerError, callbackErr},
+	}
+
+	for _, tc := range testCases {
+		var handlerErr error
+		h := NewNotificationHandler(SandboxUser("foo", "bar"), func(r *http.Request, result Result) error {
+			return tc.callback
+		})
+		h.ErrorHandler = func(r *http.Request, err error) {
+			handlerErr = err
+		}
+
+		w := postNotification(h, tc.body)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: unexpected status: %d", tc.name, w.Code)
+		}
+		if w.Body.String() == "OK" {
+			t.Errorf("%s: notification should not be acknowledged", tc.name)
+		}
+		if tc.err != nil && handlerErr != tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.name, handlerErr)
+		}
+		if tc.err == nil {
+			if _, ok := handlerErr.(*RequestError); !ok {
+				t.Errorf("%s: expected a RequestError, got %v", tc.name, handlerErr)
+			}
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strings"
 )
 
 // Options is a map of name/value parameters used to represent a request to
@@ -41,36 +42,106 @@ func (p Options) copy() Options {
 	return c
 }
 
-func recurseFlatten(name string, options, result Options) {
-	for k, v := range options {
+// A Parameter is a name/value pair of a request, as it is sent to the be2bill
+// servers and hashed.
+type Parameter struct {
+	// Name is the name of the parameter, such as AMOUNTS[2016-05-14]
+	// for nested parameters.
+	Name string
+	// Value is the value of the parameter formatted as a string.
+	Value string
+}
+
+func (p Parameter) String() string {
+	return p.Name + "=" + p.Value
+}
+
+func recurseParameters(name string, options Options, result []Parameter) []Parameter {
+	for _, k := range options.sortedKeys() {
 		key := fmt.Sprintf("%s[%s]", name, k)
-		if opts, ok := v.(Options); ok {
-			recurseFlatten(key, opts, result)
+		if opts, ok := options[k].(Options); ok {
+			result = recurseParameters(key, opts, result)
 		} else {
-			result[key] = fmt.Sprint(v)
+			result = append(result, Parameter{key, fmt.Sprint(options[k])})
 		}
 	}
+	return result
 }
 
-func (p Options) flatten() Options {
-	result := Options{}
-	for k, v := range p {
-		if opts, ok := v.(Options); ok {
-			recurseFlatten(k, opts, result)
+// parameters returns the canonical representation of the options, which is
+// shared by the wire encoding, the hash and the HTML forms: nested Options are
+// expanded at any depth into names such as name[key1][key2], values are
+// formatted as strings, and parameters are sorted by name at each level.
+func (p Options) parameters() []Parameter {
+	var result []Parameter
+	for _, k := range p.sortedKeys() {
+		if opts, ok := p[k].(Options); ok {
+			result = recurseParameters(k, opts, result)
 		} else {
-			result[k] = fmt.Sprint(v)
+			result = append(result, Parameter{k, fmt.Sprint(p[k])})
 		}
 	}
 	return result
 }
 
+func (p Options) flatten() Options {
+	result := Options{}
+	for _, param := range p.parameters() {
+		result[param.Name] = param.Value
+	}
+	return result
+}
+
 func (p Options) urlValues() url.Values {
 	values := url.Values{}
-	opts := p.flatten()
+	for _, param := range p.parameters() {
+		values.Set(param.Name, param.Value)
+	}
+	return values
+}
 
-	for k, v := range opts {
-		values.Set(k, fmt.Sprint(v))
+// splitParamName splits a parameter name such as name[key1][key2] into
+// its components. Names that do not follow this syntax are returned as is.
+func splitParamName(name string) []string {
+	i := strings.IndexByte(name, '[')
+	if i <= 0 || !strings.HasSuffix(name, "]") {
+		return []string{name}
 	}
 
-	return values
+	parts := []string{name[:i]}
+	for rest := name[i:]; len(rest) > 0; {
+		end := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || end < 0 {
+			return []string{name}
+		}
+		parts = append(parts, rest[1:end])
+		rest = rest[end+1:]
+	}
+	return parts
+}
+
+// ParseOptions builds Options from the given form values, expanding names
+// such as name[key] into nested Options, as found in the requests sent by
+// the be2bill servers.
+// Only the first value of each name is kept.
+func ParseOptions(values url.Values) Options {
+	result := Options{}
+	for name, value := range values {
+		if len(value) == 0 {
+			continue
+		}
+
+		parts := splitParamName(name)
+		opts := result
+		for _, k := range parts[:len(parts)-1] {
+			sub, ok := opts[k].(Options)
+			if !ok {
+				sub = Options{}
+				opts[k] = sub
+			}
+			opts = sub
+		}
+		opts[parts[len(parts)-1]] = value[0]
+	}
+	return result
 }
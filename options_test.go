@@ -5,8 +5,12 @@
 package be2bill
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"net/url"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -153,3 +157,134 @@ func TestOptionsUrlValuesRecursive(t *testing.T) {
 		t.Errorf("Got %v, expected %v", params, expected)
 	}
 }
+
+func TestParseOptions(t *testing.T) {
+	testCases := []struct {
+		values   url.Values
+		expected Options
+	}{
+		{
+			url.Values{
+				"a": {"echo"},
+				"b": {"foo", "bar"},
+			},
+			Options{
+				"a": "echo",
+				"b": "foo",
+			},
+		},
+		{
+			url.Values{
+				"a":                   {"echo"},
+				"AMOUNTS[2016-05-14]": {"15235"},
+				"AMOUNTS[2016-06-14]": {"14723"},
+			},
+			Options{
+				"a": "echo",
+				"AMOUNTS": Options{
+					"2016-05-14": "15235",
+					"2016-06-14": "14723",
+				},
+			},
+		},
+		{
+			url.Values{
+				"params[a][b]": {"deep"},
+				"params[c]":    {"shallow"},
+				"[x]":          {"invalid"},
+				"y[z":          {"unterminated"},
+			},
+			Options{
+				"params": Options{
+					"a": Options{"b": "deep"},
+					"c": "shallow",
+				},
+				"[x]": "invalid",
+				"y[z": "unterminated",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		result := ParseOptions(tc.values)
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("Got %v, expected %v", result, tc.expected)
+		}
+	}
+}
+
+func TestCanonicalEncoding(t *testing.T) {
+	o := Options{
+		"IDENTIFIER": "foo",
+		"AMOUNTS": Options{
+			"2016-06-14": 200,
+			"2016-05-14": 100,
+		},
+		"METADATA": Options{
+			"cart": Options{
+				"items": Options{"0": "jacket", "1": "shoes"},
+				"id":    42,
+			},
+			"channel": "web",
+		},
+		"A-B":  "dash",
+		"HASH": "ignored",
+	}
+
+	// keys are sorted at each level, so METADATA[cart] fields come
+	// before METADATA[channel], and A-B after AMOUNTS
+	expected := []Parameter{
+		{"A-B", "dash"},
+		{"AMOUNTS[2016-05-14]", "100"},
+		{"AMOUNTS[2016-06-14]", "200"},
+		{"HASH", "ignored"},
+		{"IDENTIFIER", "foo"},
+		{"METADATA[cart][id]", "42"},
+		{"METADATA[cart][items][0]", "jacket"},
+		{"METADATA[cart][items][1]", "shoes"},
+		{"METADATA[channel]", "web"},
+	}
+	if params := o.parameters(); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("unexpected parameters: %v", params)
+	}
+
+	// wire encoding
+	values := url.Values{}
+	for _, param := range expected {
+		values.Set(param.Name, param.Value)
+	}
+	if v := o.urlValues(); !reflect.DeepEqual(v, values) {
+		t.Errorf("want %v, got %v", values, v)
+	}
+
+	// hash input
+	clear := "password"
+	for _, param := range expected {
+		if param.Name != ParamHash {
+			clear += param.String() + "password"
+		}
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(clear)))
+	if h := DefaultHasher().ComputeHash("password", o); h != hash {
+		t.Errorf("want hash %s, got %s", hash, h)
+	}
+
+	// the parameters received by the server have the same hash
+	if h := DefaultHasher().ComputeHash("password", ParseOptions(o.urlValues())); h != hash {
+		t.Errorf("want received hash %s, got %s", hash, h)
+	}
+
+	// hidden form fields
+	form := newHTMLRenderer("https://example.org").Render(o, Options{})
+	re := regexp.MustCompile(`<input type="hidden" name="([^"]*)" value="([^"]*)" />`)
+	var fields []Parameter
+	for _, m := range re.FindAllStringSubmatch(form, -1) {
+		fields = append(fields, Parameter{m[1], m[2]})
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("unexpected form fields: %v", fields)
+	}
+	if strings.Contains(form, "map[") {
+		t.Errorf("nested options not expanded: %s", form)
+	}
+}
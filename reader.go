@@ -0,0 +1,260 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These constants represent the column names of transaction export files
+// that are not already defined as parameters.
+const (
+	ExportColumnCurrency   = "CURRENCY"
+	ExportColumnDescriptor = "DESCRIPTOR"
+	ExportColumnExecCode   = "EXECCODE"
+	ExportColumnMessage    = "MESSAGE"
+)
+
+// exportDateLayouts are the date formats supported in transaction export files.
+var exportDateLayouts = []string{
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"2006-01-02",
+}
+
+var (
+	errInvalidAmount = errors.New("invalid amount")
+	errInvalidDate   = errors.New("invalid date")
+	errInvalidBool   = errors.New("invalid boolean")
+)
+
+// A TransactionRecord represents a transaction listed in the file sent by
+// the ExportTransactions, GetTransactionsByTransactionID and
+// GetTransactionsByOrderID operations.
+type TransactionRecord struct {
+	TransactionID string
+	OrderID       string
+	Date          time.Time
+	OperationType string
+	ExecCode      ExecCode
+	Message       string
+	// Amount is expressed in cents, as in the export file.
+	Amount      int
+	Currency    string
+	Alias       string
+	ClientIdent string
+	ClientEmail string
+	Description string
+	Descriptor  string
+	// CardCode is the masked card number used in the transaction.
+	CardCode     string
+	ThreeDSecure bool
+	// Fields contains every column of the record, indexed by name,
+	// including those that are not mapped to a field of the structure.
+	Fields map[string]string
+}
+
+// A RecordError is returned by a TransactionReader when a record cannot
+// be converted to a TransactionRecord.
+type RecordError struct {
+	Line   int    // Line where the error occurred
+	Column string // Name of the column where the error occurred
+	Err    error  // The actual error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("line %d, column %s: %v", e.Line, e.Column, e.Err)
+}
+
+// A TransactionReader reads transaction records from an export file.
+//
+// The first line of the file must contain the names of the columns,
+// which are the same as the API parameters (TRANSACTIONID, ORDERID, AMOUNT...).
+//
+// The records are read one at a time so large files can be streamed:
+//
+//	r := be2bill.NewTransactionReader(file.Body)
+//	for r.Next() {
+//		record := r.Record()
+//		...
+//	}
+//	if err := r.Err(); err != nil {
+//		...
+//	}
+type TransactionReader struct {
+	// Comma is the field delimiter, it is set to ';' by NewTransactionReader.
+	// It must be changed before the first call to Next.
+	Comma rune
+
+	reader *csv.Reader
+	header []string
+	record *TransactionRecord
+	done   bool
+	err    error
+}
+
+// NewTransactionReader returns a new TransactionReader reading from r.
+func NewTransactionReader(r io.Reader) *TransactionReader {
+	return &TransactionReader{
+		Comma:  ';',
+		reader: csv.NewReader(r),
+	}
+}
+
+// Next reads the next record, which is then available through Record.
+// It returns false when there are no more records, either because the end
+// of the file was reached or because an error occurred.
+// Err should be consulted to distinguish between the two cases.
+func (p *TransactionReader) Next() bool {
+	if p.done {
+		return false
+	}
+
+	if p.header == nil {
+		p.reader.Comma = p.Comma
+		p.reader.FieldsPerRecord = 0
+		header, err := p.reader.Read()
+		if err != nil {
+			p.fail(err)
+			return false
+		}
+		p.header = make([]string, len(header))
+		for i, name := range header {
+			p.header[i] = strings.ToUpper(strings.TrimSpace(name))
+		}
+	}
+
+	fields, err := p.reader.Read()
+	if err != nil {
+		p.fail(err)
+		return false
+	}
+
+	record, err := p.parseRecord(fields)
+	if err != nil {
+		p.fail(err)
+		return false
+	}
+	p.record = record
+	return true
+}
+
+// Record returns the last record read by Next.
+func (p *TransactionReader) Record() *TransactionRecord {
+	return p.record
+}
+
+// Err returns the first error that was encountered by the reader,
+// or nil if the end of the file was reached.
+func (p *TransactionReader) Err() error {
+	return p.err
+}
+
+func (p *TransactionReader) fail(err error) {
+	p.record = nil
+	p.done = true
+	// the end of the file is not an error
+	if err != io.EOF {
+		p.err = err
+	}
+}
+
+func (p *TransactionReader) parseRecord(fields []string) (*TransactionRecord, error) {
+	record := &TransactionRecord{
+		Fields: make(map[string]string, len(fields)),
+	}
+
+	for i, value := range fields {
+		name := p.header[i]
+		record.Fields[name] = value
+
+		var err error
+		switch name {
+		case ParamTransactionID:
+			record.TransactionID = value
+		case ParamOrderID:
+			record.OrderID = value
+		case ParamDate:
+			record.Date, err = parseExportDate(value)
+		case ParamOperationType:
+			record.OperationType = value
+		case ExportColumnExecCode:
+			record.ExecCode = ExecCode(value)
+		case ExportColumnMessage:
+			record.Message = value
+		case ParamAmount:
+			record.Amount, err = parseExportAmount(value)
+		case ExportColumnCurrency:
+			record.Currency = value
+		case ParamAlias:
+			record.Alias = value
+		case ParamClientIdent:
+			record.ClientIdent = value
+		case ParamClientEmail:
+			record.ClientEmail = value
+		case ParamDescription:
+			record.Description = value
+		case ExportColumnDescriptor:
+			record.Descriptor = value
+		case ParamCardCode:
+			record.CardCode = value
+		case Param3DSecure:
+			record.ThreeDSecure, err = parseExportBool(value)
+		}
+
+		if err != nil {
+			line, _ := p.reader.FieldPos(i)
+			return nil, &RecordError{line, name, err}
+		}
+	}
+
+	return record, nil
+}
+
+// parseExportAmount parses an amount of an export file, which is expressed
+// in cents as the AMOUNT parameter of the API.
+// Decimal amounts are rejected rather than guessed to be in currency units.
+func parseExportAmount(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	amount, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errInvalidAmount
+	}
+	return amount, nil
+}
+
+func parseExportDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range exportDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errInvalidDate
+}
+
+func parseExportBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "y", "true", "1":
+		return true, nil
+	case "no", "n", "false", "0", "":
+		return false, nil
+	}
+	return false, errInvalidBool
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransactionReader(t *testing.T) {
+	data := `TRANSACTIONID;ORDERID;DATE;OPERATIONTYPE;EXECCODE;MESSAGE;AMOUNT;CURRENCY;ALIAS;CARDCODE;3DSECURE;EXTRA
+A151621;order_1;2016-05-14 10:21:03;payment;0000;The transaction has been accepted.;15235;EUR;A151621;1111XXXXXXXX4444;yes;foo
+A151622;order_2;2016-05-15 11:00:00;refund;4001;"Refused; by bank";100;EUR;;1111XXXXXXXX4444;no;
+`
+	r := NewTransactionReader(strings.NewReader(data))
+
+	if !r.Next() {
+		t.Fatal("no record: ", r.Err())
+	}
+	rec := r.Record()
+	if rec.TransactionID != "A151621" || rec.OrderID != "order_1" {
+		t.Errorf("unexpected identifiers: %s %s", rec.TransactionID, rec.OrderID)
+	}
+	if !rec.Date.Equal(time.Date(2016, 5, 14, 10, 21, 3, 0, time.UTC)) {
+		t.Errorf("unexpected date: %v", rec.Date)
+	}
+	if rec.OperationType != OperationTypePayment || rec.ExecCode != ExecCodeSuccess {
+		t.Errorf("unexpected operation: %s %s", rec.OperationType, rec.ExecCode)
+	}
+	if rec.Amount != 15235 || rec.Currency != "EUR" {
+		t.Errorf("unexpected amount: %d %s", rec.Amount, rec.Currency)
+	}
+	if rec.Alias != "A151621" || rec.CardCode != "1111XXXXXXXX4444" || !rec.ThreeDSecure {
+		t.Errorf("unexpected card data: %s %s %v", rec.Alias, rec.CardCode, rec.ThreeDSecure)
+	}
+	if rec.Fields["EXTRA"] != "foo" {
+		t.Errorf("unexpected extra field: %s", rec.Fields["EXTRA"])
+	}
+
+	if !r.Next() {
+		t.Fatal("no record: ", r.Err())
+	}
+	rec = r.Record()
+	if rec.Message != "Refused; by bank" || rec.Amount != 100 || rec.ThreeDSecure {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+
+	if r.Next() {
+		t.Error("unexpected record")
+	}
+	if r.Err() != nil {
+		t.Errorf("unexpected error: %v", r.Err())
+	}
+	if r.Record() != nil {
+		t.Error("record should be nil")
+	}
+}
+
+func TestTransactionReaderErrors(t *testing.T) {
+	testCases := []struct {
+		data   string
+		line   int
+		column string
+	}{
+		{"ORDERID;AMOUNT\norder_1;100\norder_2;abc\n", 3, ParamAmount},
+		{"ORDERID;DATE\norder_1;2016-05-14\norder_2;2016-05-14\norder_3;yesterday\n", 4, ParamDate},
+		{"ORDERID;3DSECURE\norder_1;maybe\n", 2, Param3DSecure},
+	}
+
+	for _, tc := range testCases {
+		r := NewTransactionReader(strings.NewReader(tc.data))
+		for r.Next() {
+		}
+
+		err, ok := r.Err().(*RecordError)
+		if !ok {
+			t.Errorf("expected a RecordError, got %v", r.Err())
+			continue
+		}
+		if err.Line != tc.line || err.Column != tc.column {
+			t.Errorf("unexpected error position: %v", err)
+		}
+	}
+
+	// wrong number of fields
+	r := NewTransactionReader(strings.NewReader("ORDERID;AMOUNT\norder_1;100\norder_2\n"))
+	for r.Next() {
+	}
+	if err, ok := r.Err().(*csv.ParseError); !ok || err.Line != 3 {
+		t.Errorf("unexpected error: %v", r.Err())
+	}
+}
+
+func TestParseExportAmount(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected int
+		valid    bool
+	}{
+		{"15235", 15235, true},
+		{" 100 ", 100, true},
+		{"-50", -50, true},
+		{"", 0, true},
+		// amounts are in cents, decimal amounts would be 100 times off
+		{"100.0", 0, false},
+		{"152.35", 0, false},
+		{"152,35", 0, false},
+		{"152.", 0, false},
+		{"abc", 0, false},
+	}
+
+	for _, tc := range testCases {
+		amount, err := parseExportAmount(tc.value)
+		if (err == nil) != tc.valid || amount != tc.expected {
+			t.Errorf("%q: got %d, %v", tc.value, amount, err)
+		}
+	}
+}
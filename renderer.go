@@ -6,7 +6,6 @@ package be2bill
 
 import (
 	"bytes"
-	"fmt"
 	"html/template"
 )
 
@@ -28,8 +27,8 @@ const (
   {{template "submit" .Submit}}
 </form>`
 
-	hiddenTemplate = `{{range $name, $value := .}}
-  <input type="hidden" name="{{$name}}" value="{{$value}}" />{{end}}`
+	hiddenTemplate = `{{range .}}
+  <input type="hidden" name="{{.Name}}" value="{{.Value}}" />{{end}}`
 
 	submitTemplate = `<input type="submit"{{range $name, $value := .}} {{name $name}}="{{$value}}"{{end}} />`
 )
@@ -37,7 +36,7 @@ const (
 type templateContents struct {
 	URL        string
 	Attributes Options
-	Hidden     Options
+	Hidden     []Parameter
 	Submit     Options
 }
 
@@ -74,16 +73,7 @@ func (p *htmlRenderer) Render(params, htmlOptions Options) string {
 	}
 
 	// hidden input fields
-	data.Hidden = make(Options)
-	for name, value := range params {
-		if valueMap, ok := value.(Options); ok {
-			for _, k := range valueMap.sortedKeys() {
-				data.Hidden[fmt.Sprintf("%s[%s]", name, k)] = valueMap[k]
-			}
-		} else {
-			data.Hidden[name] = value
-		}
-	}
+	data.Hidden = params.parameters()
 
 	// submit input attributes
 	if submitOptions, ok := htmlOptions[HTMLOptionSubmit].(Options); ok {
@@ -0,0 +1,523 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// A ValidationError is returned when a request is missing a required field
+// or when one of its fields has an invalid value.
+// For security reasons, the value of the field is never part of the error.
+type ValidationError struct {
+	Field  string // Name of the invalid field
+	Reason string // Description of the problem
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid " + e.Field + ": " + e.Reason
+}
+
+func requiredField(field, value string) error {
+	if value == "" {
+		return &ValidationError{field, "missing value"}
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// A Card represents the card holder information used to perform a transaction.
+type Card struct {
+	// PAN is the card number.
+	PAN string
+	// ValidityDate is the expiry date of the card, formatted as MM-YY.
+	ValidityDate string
+	// CVV is the cryptogram printed on the back of the card.
+	CVV string
+	// FullName is the name of the card holder.
+	FullName string
+}
+
+// Validate checks that every field of the card is present and well formed.
+func (p *Card) Validate() error {
+	if err := requiredField("Card.PAN", p.PAN); err != nil {
+		return err
+	}
+	if !isDigits(p.PAN) {
+		return &ValidationError{"Card.PAN", "must only contain digits"}
+	}
+	if err := requiredField("Card.ValidityDate", p.ValidityDate); err != nil {
+		return err
+	}
+	if len(p.ValidityDate) != 5 || p.ValidityDate[2] != '-' ||
+		!isDigits(p.ValidityDate[:2]) || !isDigits(p.ValidityDate[3:]) {
+		return &ValidationError{"Card.ValidityDate", "must be formatted as MM-YY"}
+	}
+	if err := requiredField("Card.CVV", p.CVV); err != nil {
+		return err
+	}
+	if !isDigits(p.CVV) {
+		return &ValidationError{"Card.CVV", "must only contain digits"}
+	}
+	return requiredField("Card.FullName", p.FullName)
+}
+
+func (p *Card) setParams(params Options) {
+	params[ParamCardCode] = p.PAN
+	params[ParamCardValidityDate] = p.ValidityDate
+	params[ParamCardCVV] = p.CVV
+	params[ParamCardFullName] = p.FullName
+}
+
+// An Order represents the order and customer information required by
+// every transaction request.
+type Order struct {
+	// OrderID is the merchant identifier of the order.
+	OrderID string
+	// ClientID is the merchant identifier of the customer.
+	ClientID string
+	// ClientEmail is the email address of the customer.
+	ClientEmail string
+	// ClientIP is the IP address of the customer.
+	ClientIP string
+	// Description is the description of the order.
+	Description string
+	// ClientUserAgent is the user agent of the customer's browser.
+	ClientUserAgent string
+}
+
+// Validate checks that every field of the order is present and well formed.
+func (p *Order) Validate() error {
+	if err := requiredField("OrderID", p.OrderID); err != nil {
+		return err
+	}
+	if err := requiredField("ClientID", p.ClientID); err != nil {
+		return err
+	}
+	if err := requiredField("ClientEmail", p.ClientEmail); err != nil {
+		return err
+	}
+	if !strings.Contains(p.ClientEmail, "@") || strings.ContainsAny(p.ClientEmail, " \t") {
+		return &ValidationError{"ClientEmail", "must be an email address"}
+	}
+	if err := requiredField("ClientIP", p.ClientIP); err != nil {
+		return err
+	}
+	if net.ParseIP(p.ClientIP) == nil {
+		return &ValidationError{"ClientIP", "must be an IP address"}
+	}
+	if err := requiredField("Description", p.Description); err != nil {
+		return err
+	}
+	return requiredField("ClientUserAgent", p.ClientUserAgent)
+}
+
+func validateAmount(amount Amount) error {
+	switch a := amount.(type) {
+	case nil:
+		return &ValidationError{"Amount", "missing value"}
+	case SingleAmount:
+		return validateIntAmount(int(a))
+	case FragmentedAmount:
+		if len(a) == 0 {
+			return &ValidationError{"Amount", "missing value"}
+		}
+	}
+	return nil
+}
+
+func validateIntAmount(amount int) error {
+	if amount <= 0 {
+		return &ValidationError{"Amount", "must be positive"}
+	}
+	return nil
+}
+
+func setAmountParams(amount Amount, params Options) {
+	// Handle N-Time payments
+	if amount.Immediate() {
+		params[ParamAmount] = amount
+	} else {
+		params[ParamAmounts] = amount.Options()
+	}
+}
+
+// A PaymentRequest describes a payment operation using card holder information.
+// Immediate and fragmented amounts are supported.
+type PaymentRequest struct {
+	Card   Card
+	Amount Amount
+	Order
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete and well formed.
+func (p *PaymentRequest) Validate() error {
+	if err := p.Card.Validate(); err != nil {
+		return err
+	}
+	if err := validateAmount(p.Amount); err != nil {
+		return err
+	}
+	return p.Order.Validate()
+}
+
+// An AuthorizationRequest describes an authorization operation using
+// card holder information.
+type AuthorizationRequest struct {
+	Card Card
+	// Amount is the authorized amount, in cents.
+	Amount int
+	Order
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete and well formed.
+func (p *AuthorizationRequest) Validate() error {
+	if err := p.Card.Validate(); err != nil {
+		return err
+	}
+	if err := validateIntAmount(p.Amount); err != nil {
+		return err
+	}
+	return p.Order.Validate()
+}
+
+// A CreditRequest describes a credit operation using card holder information.
+type CreditRequest struct {
+	Card Card
+	// Amount is the credited amount, in cents.
+	Amount int
+	Order
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete and well formed.
+func (p *CreditRequest) Validate() error {
+	if err := p.Card.Validate(); err != nil {
+		return err
+	}
+	if err := validateIntAmount(p.Amount); err != nil {
+		return err
+	}
+	return p.Order.Validate()
+}
+
+// An AliasPaymentRequest describes a one-click or subscription payment
+// operation for an already registered client.
+// Immediate and fragmented amounts are supported.
+type AliasPaymentRequest struct {
+	// Alias is the alias created in a previous payment or authorization.
+	Alias  string
+	Amount Amount
+	Order
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete and well formed.
+func (p *AliasPaymentRequest) Validate() error {
+	if err := requiredField("Alias", p.Alias); err != nil {
+		return err
+	}
+	if err := validateAmount(p.Amount); err != nil {
+		return err
+	}
+	return p.Order.Validate()
+}
+
+// An AliasAuthorizationRequest describes a one-click or subscription
+// authorization operation for an already registered client.
+type AliasAuthorizationRequest struct {
+	// Alias is the alias created in a previous payment or authorization.
+	Alias string
+	// Amount is the authorized amount, in cents.
+	Amount int
+	Order
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete and well formed.
+func (p *AliasAuthorizationRequest) Validate() error {
+	if err := requiredField("Alias", p.Alias); err != nil {
+		return err
+	}
+	if err := validateIntAmount(p.Amount); err != nil {
+		return err
+	}
+	return p.Order.Validate()
+}
+
+// A RedirectForPaymentRequest describes a payment operation made through
+// an alternative payment service such as PayPal.
+type RedirectForPaymentRequest struct {
+	// Amount is the amount of the payment, in cents.
+	Amount int
+	Order
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete and well formed.
+func (p *RedirectForPaymentRequest) Validate() error {
+	if err := validateIntAmount(p.Amount); err != nil {
+		return err
+	}
+	return p.Order.Validate()
+}
+
+// A CaptureRequest describes a capture operation on a previous authorization.
+//
+// An optional amount can be specified in the options. It will replace
+// the authorized amount so the capture will be partial.
+type CaptureRequest struct {
+	// TransactionID is the identifier of the authorization.
+	TransactionID string
+	OrderID       string
+	Description   string
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete.
+func (p *CaptureRequest) Validate() error {
+	if err := requiredField("TransactionID", p.TransactionID); err != nil {
+		return err
+	}
+	if err := requiredField("OrderID", p.OrderID); err != nil {
+		return err
+	}
+	return requiredField("Description", p.Description)
+}
+
+// A RefundRequest describes a refund operation over a previous transaction.
+//
+// An optional amount can be specified in the options, for partial refunds.
+type RefundRequest struct {
+	// TransactionID is the identifier of the refunded transaction.
+	TransactionID string
+	OrderID       string
+	Description   string
+	// Options contains additional parameters for the operation.
+	Options Options
+}
+
+// Validate checks that the request is complete.
+func (p *RefundRequest) Validate() error {
+	if err := requiredField("TransactionID", p.TransactionID); err != nil {
+		return err
+	}
+	if err := requiredField("OrderID", p.OrderID); err != nil {
+		return err
+	}
+	return requiredField("Description", p.Description)
+}
+
+// ProcessPayment validates the given request, then performs a payment
+// operation as described in Payment.
+func (p *DirectLinkClient) ProcessPayment(ctx context.Context, req *PaymentRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.payment(ctx, req)
+}
+
+// payment performs a payment operation without validating the request.
+func (p *DirectLinkClient) payment(ctx context.Context, req *PaymentRequest) (Result, error) {
+	params := req.Options.copy()
+
+	setAmountParams(req.Amount, params)
+	params[ParamOperationType] = OperationTypePayment
+	req.Card.setParams(params)
+
+	return p.transaction(ctx, &req.Order, params)
+}
+
+// ProcessAuthorization validates the given request, then performs
+// an authorization operation as described in Authorization.
+func (p *DirectLinkClient) ProcessAuthorization(ctx context.Context, req *AuthorizationRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.authorization(ctx, req)
+}
+
+// authorization performs an authorization operation without validating
+// the request.
+func (p *DirectLinkClient) authorization(ctx context.Context, req *AuthorizationRequest) (Result, error) {
+	params := req.Options.copy()
+
+	params[ParamOperationType] = OperationTypeAuthorization
+	req.Card.setParams(params)
+	params[ParamAmount] = req.Amount
+
+	return p.transaction(ctx, &req.Order, params)
+}
+
+// ProcessCredit validates the given request, then performs a credit
+// operation as described in Credit.
+func (p *DirectLinkClient) ProcessCredit(ctx context.Context, req *CreditRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.credit(ctx, req)
+}
+
+// credit performs a credit operation without validating the request.
+func (p *DirectLinkClient) credit(ctx context.Context, req *CreditRequest) (Result, error) {
+	params := req.Options.copy()
+
+	params[ParamOperationType] = OperationTypeCredit
+	req.Card.setParams(params)
+	params[ParamAmount] = req.Amount
+
+	return p.transaction(ctx, &req.Order, params)
+}
+
+// ProcessOneClickPayment validates the given request, then performs
+// a payment operation as described in OneClickPayment.
+func (p *DirectLinkClient) ProcessOneClickPayment(ctx context.Context, req *AliasPaymentRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.aliasPayment(ctx, req, aliasModeOneClick)
+}
+
+// ProcessSubscriptionPayment validates the given request, then performs
+// a payment operation as described in SubscriptionPayment.
+func (p *DirectLinkClient) ProcessSubscriptionPayment(ctx context.Context, req *AliasPaymentRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.aliasPayment(ctx, req, aliasModeSubscription)
+}
+
+// aliasPayment performs a payment operation with the given alias mode,
+// without validating the request.
+func (p *DirectLinkClient) aliasPayment(ctx context.Context, req *AliasPaymentRequest, aliasMode string) (Result, error) {
+	params := req.Options.copy()
+
+	setAmountParams(req.Amount, params)
+	params[ParamOperationType] = OperationTypePayment
+	params[ParamAlias] = req.Alias
+	params[ParamAliasMode] = aliasMode
+
+	return p.transaction(ctx, &req.Order, params)
+}
+
+// ProcessOneClickAuthorization validates the given request, then performs
+// an authorization operation as described in OneClickAuthorization.
+func (p *DirectLinkClient) ProcessOneClickAuthorization(ctx context.Context, req *AliasAuthorizationRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.aliasAuthorization(ctx, req, aliasModeOneClick)
+}
+
+// ProcessSubscriptionAuthorization validates the given request, then performs
+// an authorization operation as described in SubscriptionAuthorization.
+func (p *DirectLinkClient) ProcessSubscriptionAuthorization(ctx context.Context, req *AliasAuthorizationRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.aliasAuthorization(ctx, req, aliasModeSubscription)
+}
+
+// aliasAuthorization performs an authorization operation with the given
+// alias mode, without validating the request.
+func (p *DirectLinkClient) aliasAuthorization(ctx context.Context, req *AliasAuthorizationRequest, aliasMode string) (Result, error) {
+	params := req.Options.copy()
+
+	params[ParamOperationType] = OperationTypeAuthorization
+	params[ParamAlias] = req.Alias
+	params[ParamAliasMode] = aliasMode
+	params[ParamAmount] = req.Amount
+
+	return p.transaction(ctx, &req.Order, params)
+}
+
+// ProcessRedirectForPayment validates the given request, then performs
+// a payment operation as described in RedirectForPayment.
+func (p *DirectLinkClient) ProcessRedirectForPayment(ctx context.Context, req *RedirectForPaymentRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.redirectForPayment(ctx, req)
+}
+
+// redirectForPayment performs a payment operation with a redirection,
+// without validating the request.
+func (p *DirectLinkClient) redirectForPayment(ctx context.Context, req *RedirectForPaymentRequest) (Result, error) {
+	params := req.Options.copy()
+
+	params[ParamOperationType] = OperationTypePayment
+	params[ParamAmount] = req.Amount
+
+	return p.transaction(ctx, &req.Order, params)
+}
+
+// ProcessCapture validates the given request, then performs a capture
+// operation as described in Capture.
+func (p *DirectLinkClient) ProcessCapture(ctx context.Context, req *CaptureRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.capture(ctx, req)
+}
+
+// capture performs a capture operation without validating the request.
+func (p *DirectLinkClient) capture(ctx context.Context, req *CaptureRequest) (Result, error) {
+	params := req.Options.copy()
+
+	params[ParamIdentifier] = p.credentials.identifier
+	params[ParamOperationType] = OperationTypeCapture
+	params[ParamVersion] = APIVersion
+	params[ParamDescription] = req.Description
+	params[ParamTransactionID] = req.TransactionID
+	params[ParamOrderID] = req.OrderID
+
+	params[ParamHash] = p.signer().Sign(params)
+
+	return p.requests(ctx, directLinkPath, params)
+}
+
+// ProcessRefund validates the given request, then performs a refund
+// operation as described in Refund.
+func (p *DirectLinkClient) ProcessRefund(ctx context.Context, req *RefundRequest) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.refund(ctx, req)
+}
+
+// refund performs a refund operation without validating the request.
+func (p *DirectLinkClient) refund(ctx context.Context, req *RefundRequest) (Result, error) {
+	params := req.Options.copy()
+
+	params[ParamIdentifier] = p.credentials.identifier
+	params[ParamOperationType] = OperationTypeRefund
+	params[ParamDescription] = req.Description
+	params[ParamTransactionID] = req.TransactionID
+	params[ParamVersion] = APIVersion
+	params[ParamOrderID] = req.OrderID
+
+	params[ParamHash] = p.signer().Sign(params)
+
+	return p.requests(ctx, directLinkPath, params)
+}
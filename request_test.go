@@ -0,0 +1,206 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func validOrder() Order {
+	return Order{
+		OrderID:         "order_1423675675",
+		ClientID:        "6328_john.smith",
+		ClientEmail:     "john.smith@example.org",
+		ClientIP:        "123.123.123.123",
+		Description:     "Fashion jacket",
+		ClientUserAgent: "Firefox",
+	}
+}
+
+func validCard() Card {
+	return Card{
+		PAN:          "1111222233334444",
+		ValidityDate: "01-30",
+		CVV:          "123",
+		FullName:     "John Smith",
+	}
+}
+
+func TestRequestValidate(t *testing.T) {
+	swapped := validOrder()
+	swapped.ClientEmail, swapped.ClientIP = swapped.ClientIP, swapped.ClientEmail
+
+	noEmail := validOrder()
+	noEmail.ClientEmail = ""
+
+	badDate := validCard()
+	badDate.ValidityDate = "2030-01"
+
+	badPAN := validCard()
+	badPAN.PAN = "1111 2222 3333 4444"
+
+	testCases := []struct {
+		request interface {
+			Validate() error
+		}
+		field string
+	}{
+		{&PaymentRequest{Card: validCard(), Amount: SingleAmount(100), Order: validOrder()}, ""},
+		{&PaymentRequest{Card: validCard(), Amount: FragmentedAmount{"2016-05-14": 100}, Order: validOrder()}, ""},
+		{&PaymentRequest{Card: validCard(), Order: validOrder()}, "Amount"},
+		{&PaymentRequest{Card: validCard(), Amount: FragmentedAmount{}, Order: validOrder()}, "Amount"},
+		{&PaymentRequest{Card: validCard(), Amount: SingleAmount(100), Order: swapped}, "ClientEmail"},
+		{&PaymentRequest{Card: validCard(), Amount: SingleAmount(100), Order: noEmail}, "ClientEmail"},
+		{&PaymentRequest{Card: badDate, Amount: SingleAmount(100), Order: validOrder()}, "Card.ValidityDate"},
+		{&PaymentRequest{Card: badPAN, Amount: SingleAmount(100), Order: validOrder()}, "Card.PAN"},
+		{&AuthorizationRequest{Card: validCard(), Amount: 100, Order: validOrder()}, ""},
+		{&AuthorizationRequest{Card: validCard(), Amount: 0, Order: validOrder()}, "Amount"},
+		{&CreditRequest{Card: Card{}, Amount: 100, Order: validOrder()}, "Card.PAN"},
+		{&AliasPaymentRequest{Alias: "A151621", Amount: SingleAmount(100), Order: validOrder()}, ""},
+		{&AliasPaymentRequest{Amount: SingleAmount(100), Order: validOrder()}, "Alias"},
+		{&AliasAuthorizationRequest{Alias: "A151621", Amount: -1, Order: validOrder()}, "Amount"},
+		{&RedirectForPaymentRequest{Amount: 100, Order: Order{}}, "OrderID"},
+		{&CaptureRequest{TransactionID: "A151621", OrderID: "order_1", Description: "capture"}, ""},
+		{&CaptureRequest{OrderID: "order_1", Description: "capture"}, "TransactionID"},
+		{&RefundRequest{TransactionID: "A151621", OrderID: "order_1"}, "Description"},
+	}
+
+	for i, tc := range testCases {
+		err := tc.request.Validate()
+		if tc.field == "" {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%d: expected a ValidationError, got %v", i, err)
+			continue
+		}
+		if verr.Field != tc.field {
+			t.Errorf("%d: expected invalid field %s, got %s", i, tc.field, verr.Field)
+		}
+	}
+}
+
+func TestProcessPayment(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		params := requestParameters(r.Form)
+		checkParams(params, t)
+
+		expected := map[string]string{
+			ParamOperationType:    OperationTypePayment,
+			ParamCardCode:         "1111222233334444",
+			ParamCardValidityDate: "01-30",
+			ParamCardCVV:          "123",
+			ParamCardFullName:     "John Smith",
+			ParamAmount:           "15235",
+			ParamOrderID:          "order_1423675675",
+			ParamClientIdent:      "6328_john.smith",
+			ParamClientEmail:      "john.smith@example.org",
+			ParamClientIP:         "123.123.123.123",
+			ParamDescription:      "Fashion jacket",
+			ParamClientUserAgent:  "Firefox",
+			Param3DSecure:         "yes",
+		}
+		for k, v := range expected {
+			if params[k] != v {
+				t.Errorf("invalid %s parameter, want %s, got %v", k, v, params[k])
+			}
+		}
+
+		fmt.Fprint(w, `{"OPERATIONTYPE":"payment","TRANSACTIONID":"ABCDE01","EXECCODE":"0000","MESSAGE":"ok"}`)
+	}))
+	defer ts.Close()
+
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+
+	r, err := c.ProcessPayment(context.Background(), &PaymentRequest{
+		Card:    validCard(),
+		Amount:  SingleAmount(15235),
+		Order:   validOrder(),
+		Options: Options{Param3DSecure: "yes"},
+	})
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if !r.Success() {
+		t.Errorf("exec code %s, message: %s", r.ExecCode(), r.Message())
+	}
+}
+
+func TestInvalidRequestNotSent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("invalid request should not be sent")
+	}))
+	defer ts.Close()
+
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+
+	// client IP and email swapped
+	order := validOrder()
+	order.ClientIP, order.ClientEmail = order.ClientEmail, order.ClientIP
+	r, err := c.ProcessPayment(context.Background(), &PaymentRequest{
+		Card:   validCard(),
+		Amount: SingleAmount(100),
+		Order:  order,
+	})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Errorf("expected a ValidationError, got %v", err)
+	}
+	if r != nil {
+		t.Error("r should be nil")
+	}
+}
+
+func TestPositionalMethodsNotValidated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		params := requestParameters(r.Form)
+		if params[ParamCardCode] != "1111 2222 3333 4444" || params[ParamCardValidityDate] != "1/30" ||
+			params[ParamClientIP] != "localhost" || params[ParamDescription] != "" {
+			t.Errorf("unexpected parameters: %v", params)
+		}
+		fmt.Fprint(w, `{"OPERATIONTYPE":"payment","TRANSACTIONID":"ABCDE01","EXECCODE":"0000","MESSAGE":"ok"}`)
+	}))
+	defer ts.Close()
+
+	c := NewDirectLinkClient(User("foo", "bar", Environment{ts.URL}))
+
+	// the positional methods send their parameters as given
+	r, err := c.Payment(
+		"1111 2222 3333 4444",
+		"1/30",
+		"123",
+		"john doe",
+		SingleAmount(100),
+		"42",
+		"ident",
+		"test@test.com",
+		"localhost",
+		"",
+		"Firefox",
+		Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success() {
+		t.Errorf("exec code %s, message: %s", r.ExecCode(), r.Message())
+	}
+}
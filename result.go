@@ -0,0 +1,138 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// A TransactionResult is the typed representation of the Result of
+// a transaction operation such as a payment, an authorization,
+// a capture or a refund.
+type TransactionResult struct {
+	OperationType string
+	ExecCode      ExecCode
+	Message       string
+	TransactionID string
+	OrderID       string
+	Descriptor    string
+	// Amount is expressed in cents.
+	Amount int
+	Alias  string
+	// CardCode is the masked card number used in the transaction.
+	CardCode     string
+	ThreeDSecure bool
+	// RedirectHTML is the Base64 representation of the HTML code returned
+	// when a 3-D Secure authentication or a redirection is required.
+	RedirectHTML string
+	// Raw contains every value returned by the server, including those
+	// that are not mapped to a field of the structure.
+	Raw Result
+}
+
+// Success returns true if the operation succeeded, false otherwise.
+func (p *TransactionResult) Success() bool {
+	return p.ExecCode == ExecCodeSuccess
+}
+
+// UnmarshalJSON decodes a TransactionResult from the JSON response of
+// the be2bill servers.
+func (p *TransactionResult) UnmarshalJSON(data []byte) error {
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	*p = *r.Transaction()
+	return nil
+}
+
+// An ExportResult is the typed representation of the Result of an export
+// or transaction search operation.
+type ExportResult struct {
+	OperationType string
+	ExecCode      ExecCode
+	Message       string
+	Descriptor    string
+	// Raw contains every value returned by the server, including those
+	// that are not mapped to a field of the structure.
+	Raw Result
+}
+
+// Success returns true if the operation succeeded, false otherwise.
+func (p *ExportResult) Success() bool {
+	return p.ExecCode == ExecCodeSuccess
+}
+
+// UnmarshalJSON decodes an ExportResult from the JSON response of
+// the be2bill servers.
+func (p *ExportResult) UnmarshalJSON(data []byte) error {
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	*p = *r.Export()
+	return nil
+}
+
+// Transaction returns the typed representation of a transaction result.
+func (r Result) Transaction() *TransactionResult {
+	return &TransactionResult{
+		OperationType: r.OperationType(),
+		ExecCode:      r.ExecCode(),
+		Message:       r.Message(),
+		TransactionID: r.TransactionID(),
+		OrderID:       r.OrderID(),
+		Descriptor:    r.StringValue(ResultParamDescriptor),
+		Amount:        r.intValue(ResultParamAmount),
+		Alias:         r.Alias(),
+		CardCode:      r.StringValue(ResultParamCardCode),
+		ThreeDSecure:  r.boolValue(ResultParam3DSecure),
+		RedirectHTML:  r.StringValue(ResultParamRedirectHTML),
+		Raw:           r,
+	}
+}
+
+// Export returns the typed representation of an export result.
+func (r Result) Export() *ExportResult {
+	return &ExportResult{
+		OperationType: r.OperationType(),
+		ExecCode:      r.ExecCode(),
+		Message:       r.Message(),
+		Descriptor:    r.StringValue(ResultParamDescriptor),
+		Raw:           r,
+	}
+}
+
+// intValue returns the value for the given property as an integer,
+// whether it was sent as a JSON number or as a string.
+// Zero is returned if the value is missing or invalid.
+func (r Result) intValue(name string) int {
+	switch v := r[name].(type) {
+	case float64:
+		return int(v)
+	case json.Number:
+		i, _ := strconv.Atoi(v.String())
+		return i
+	case string:
+		i, _ := strconv.Atoi(strings.TrimSpace(v))
+		return i
+	}
+	return 0
+}
+
+// boolValue returns the value for the given property as a boolean,
+// whether it was sent as a JSON boolean or as a yes/no string.
+func (r Result) boolValue(name string) bool {
+	switch v := r[name].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := parseExportBool(v)
+		return b
+	}
+	return false
+}
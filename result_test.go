@@ -0,0 +1,99 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransactionResult(t *testing.T) {
+	data := `{
+		"OPERATIONTYPE": "payment",
+		"TRANSACTIONID": "A151621",
+		"ORDERID": "order_1423675675",
+		"EXECCODE": "0001",
+		"MESSAGE": "3DSecure authentication required",
+		"DESCRIPTOR": "descr",
+		"AMOUNT": 15235,
+		"ALIAS": "A151621",
+		"CARDCODE": "1111XXXXXXXX4444",
+		"3DSECURE": "yes",
+		"REDIRECTHTML": "PGh0bWw+",
+		"EXTRADATA": "foo"
+	}`
+
+	var r TransactionResult
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.OperationType != OperationTypePayment || r.ExecCode != ExecCode3DSecureRequired {
+		t.Errorf("unexpected operation: %s %s", r.OperationType, r.ExecCode)
+	}
+	if r.Success() {
+		t.Error("invalid success status")
+	}
+	if r.TransactionID != "A151621" || r.OrderID != "order_1423675675" {
+		t.Errorf("unexpected identifiers: %s %s", r.TransactionID, r.OrderID)
+	}
+	if r.Amount != 15235 {
+		t.Errorf("unexpected amount: %d", r.Amount)
+	}
+	if r.Alias != "A151621" || r.CardCode != "1111XXXXXXXX4444" || !r.ThreeDSecure {
+		t.Errorf("unexpected card data: %s %s %v", r.Alias, r.CardCode, r.ThreeDSecure)
+	}
+	if r.Message == "" || r.Descriptor != "descr" || r.RedirectHTML != "PGh0bWw+" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r.Raw.StringValue(ParamExtraData) != "foo" {
+		t.Errorf("unexpected raw value: %v", r.Raw)
+	}
+
+	// numeric values are not strings
+	if v := r.Raw.StringValue(ResultParamAmount); v != "" {
+		t.Errorf("unexpected string value: %s", v)
+	}
+}
+
+func TestTransactionResultStringAmount(t *testing.T) {
+	r := Result{
+		ResultParamExecCode: ExecCodeSuccess,
+		ResultParamAmount:   "5000",
+		ResultParam3DSecure: true,
+	}.Transaction()
+
+	if !r.Success() {
+		t.Error("invalid success status")
+	}
+	if r.Amount != 5000 {
+		t.Errorf("unexpected amount: %d", r.Amount)
+	}
+	if !r.ThreeDSecure {
+		t.Error("unexpected 3DSecure status")
+	}
+}
+
+func TestExportResult(t *testing.T) {
+	var r ExportResult
+	err := json.Unmarshal([]byte(`{"OPERATIONTYPE":"exportTransactions","EXECCODE":"0000","MESSAGE":"ok","DESCRIPTOR":"descr"}`), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Success() {
+		t.Errorf("exec code %s, message: %s", r.ExecCode, r.Message)
+	}
+	if r.OperationType != OperationTypeExportTransactions || r.Descriptor != "descr" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if len(r.Raw) != 4 {
+		t.Errorf("unexpected raw result: %v", r.Raw)
+	}
+
+	if err := json.Unmarshal([]byte(`[]`), &r); err == nil {
+		t.Error("err should not be nil")
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// A RetryPolicy describes how DirectLinkClient operations that fail because
+// of a transient error are attempted again.
+//
+// Operations that move money (payments, authorizations, credits, captures
+// and refunds) are only retried when it is safe to do so: when the request
+// provably did not reach the server, because no connection could be made,
+// or when the Confirm function is set and confirms that no transaction was
+// created. This also applies to retryable execution codes, as a handler
+// timeout (5004) does not prove that the bank did not process the first
+// attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the delay after each attempt.
+	Multiplier float64
+	// Jitter is the fraction of each delay that is randomized,
+	// between 0 and 1.
+	Jitter float64
+	// RetryableError reports whether an operation that returned the given
+	// error can be attempted again.
+	// If nil, IsTransientError is used.
+	RetryableError func(err error) bool
+	// RetryableExecCode reports whether an operation that returned the given
+	// execution code can be attempted again.
+	// If nil, ExecCode.Retryable is used, which accepts 5001, 5002 and 5004.
+	RetryableExecCode func(code ExecCode) bool
+	// Confirm is called before retrying an operation that moves money and
+	// whose request may have been processed by the server.
+	// It must return true only if it is certain that no transaction was
+	// created for the given request parameters.
+	// If it returns an error, the operation is not retried and returns
+	// a *ConfirmError.
+	// If nil, such operations are never retried.
+	Confirm func(ctx context.Context, params Options) (bool, error)
+}
+
+// DefaultRetryPolicy returns a new RetryPolicy making up to 3 attempts,
+// with an exponential backoff starting at 500 milliseconds.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// ConfirmByOrderID returns a function suitable for the Confirm field of
+// a RetryPolicy, that uses GetTransactionsByOrderID to check whether
+// a transaction exists for the order of the request.
+// The transaction list is sent to the given destination, which can be
+// an HTTP URL or an email address.
+func ConfirmByOrderID(client *DirectLinkClient, destination string) func(ctx context.Context, params Options) (bool, error) {
+	return func(ctx context.Context, params Options) (bool, error) {
+		orderID, ok := params[ParamOrderID].(string)
+		if !ok || orderID == "" {
+			return false, nil
+		}
+
+		result, err := client.GetTransactionsByOrderIDContext(ctx, []string{orderID}, destination, CompressionGzip)
+		if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+			return false, err
+		}
+		return result.ExecCode() == ExecCodeTransactionNotFound, nil
+	}
+}
+
+// IsTransientError reports whether the given error is caused by a temporary
+// condition, such as a timeout, a server error or a network failure.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if err == ErrTimeout || errors.Is(err, ErrServerError) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isNotSent reports whether the error proves that the request never
+// reached the server, because the connection could not be established.
+func isNotSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// movesMoney reports whether the operation described by the given parameters
+// can create a financial transaction.
+func movesMoney(params Options) bool {
+	switch params[ParamOperationType] {
+	case OperationTypePayment, OperationTypeAuthorization, OperationTypeCredit,
+		OperationTypeCapture, OperationTypeRefund:
+		return true
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryableExecCode(code ExecCode) bool {
+	if p.RetryableExecCode != nil {
+		return p.RetryableExecCode(code)
+	}
+	return code.Retryable()
+}
+
+func (p *RetryPolicy) retryableError(err error) bool {
+	if p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+	return IsTransientError(err)
+}
+
+// shouldRetry reports whether an operation with the given parameters that
+// returned the given result and error can safely be attempted again.
+// It returns the error of the Confirm function, if it fails.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, params Options, result Result, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	var execErr *ExecError
+	switch {
+	case errors.As(err, &execErr):
+		// the server answered with a transient failure
+		if !p.retryableExecCode(execErr.ExecCode()) {
+			return false, nil
+		}
+	case err == nil:
+		if result == nil || !p.retryableExecCode(result.ExecCode()) {
+			return false, nil
+		}
+	case !p.retryableError(err):
+		return false, nil
+	case isNotSent(err):
+		return true, nil
+	}
+
+	if !movesMoney(params) {
+		return true, nil
+	}
+	if p.Confirm == nil {
+		return false, nil
+	}
+	return p.Confirm(ctx, params)
+}
+
+// A ConfirmError is returned by an operation that could not be retried
+// because the Confirm function of the RetryPolicy failed.
+type ConfirmError struct {
+	// Err is the error of the last attempt, if any.
+	Err error
+	// ConfirmErr is the error returned by the Confirm function.
+	ConfirmErr error
+}
+
+func (e *ConfirmError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v (retry not confirmed: %v)", e.Err, e.ConfirmErr)
+	}
+	return fmt.Sprintf("retry not confirmed: %v", e.ConfirmErr)
+}
+
+// Unwrap returns the error of the last attempt, if any.
+// The error of the Confirm function is only available in ConfirmErr.
+func (e *ConfirmError) Unwrap() error {
+	return e.Err
+}
+
+// backoff returns the delay to wait after the given attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// do calls send until it succeeds, the error is not retryable, or
+// the maximum number of attempts is reached.
+func (p *RetryPolicy) do(ctx context.Context, params Options, send func() (Result, error)) (Result, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := send()
+		if attempt >= p.MaxAttempts {
+			return result, err
+		}
+		retry, confirmErr := p.shouldRetry(ctx, params, result, err)
+		if confirmErr != nil {
+			return result, &ConfirmError{Err: err, ConfirmErr: confirmErr}
+		}
+		if !retry {
+			return result, err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+// sequenceTransport answers each request with the next response of
+// the sequence, the last one being repeated.
+type sequenceTransport struct {
+	responses []func(r *http.Request) (*http.Response, error)
+	calls     int
+}
+
+func (p *sequenceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	i := p.calls
+	if i >= len(p.responses) {
+		i = len(p.responses) - 1
+	}
+	p.calls++
+	return p.responses[i](r)
+}
+
+func dialFailure(r *http.Request) (*http.Response, error) {
+	return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+}
+
+func serverFailure(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Body:       ioutil.NopCloser(strings.NewReader("internal server error")),
+		Request:    r,
+	}, nil
+}
+
+func execCodeResponse(execCode ExecCode) func(r *http.Request) (*http.Response, error) {
+	return func(r *http.Request) (*http.Response, error) {
+		body := fmt.Sprintf(`{"TRANSACTIONID":"ABCDE01","EXECCODE":"%s","MESSAGE":"message"}`, execCode)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	}
+}
+
+func retryClient(transport *sequenceTransport, policy *RetryPolicy) *DirectLinkClient {
+	c := NewDirectLinkClient(User("foo", "bar", Environment{"https://secure.example.org"}))
+	c.HTTPClient = &http.Client{Transport: transport}
+	c.RetryPolicy = policy
+	return c
+}
+
+func paymentRequest() *PaymentRequest {
+	return &PaymentRequest{
+		Card:   validCard(),
+		Amount: SingleAmount(100),
+		Order:  validOrder(),
+	}
+}
+
+func TestNoRetryPolicy(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		dialFailure,
+		execCodeResponse(ExecCodeSuccess),
+	}}
+	c := retryClient(transport, nil)
+
+	_, err := c.ProcessPayment(context.Background(), paymentRequest())
+	if err == nil {
+		t.Error("err should not be nil")
+	}
+	if transport.calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.calls)
+	}
+}
+
+func TestRetryNotSent(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		dialFailure,
+		execCodeResponse(ExecCodeSuccess),
+	}}
+	c := retryClient(transport, testRetryPolicy())
+
+	r, err := c.ProcessPayment(context.Background(), paymentRequest())
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if r.ExecCode() != ExecCodeSuccess {
+		t.Errorf("unexpected exec code %s", r.ExecCode())
+	}
+	if transport.calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", transport.calls)
+	}
+}
+
+func TestRetryPaymentNeedsConfirmation(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		serverFailure,
+		execCodeResponse(ExecCodeSuccess),
+	}}
+	c := retryClient(transport, testRetryPolicy())
+
+	_, err := c.ProcessPayment(context.Background(), paymentRequest())
+	if err != ErrServerError {
+		t.Errorf("expected ErrServerError, got %v", err)
+	}
+	if transport.calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.calls)
+	}
+}
+
+func TestRetryPaymentConfirmed(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		serverFailure,
+		execCodeResponse(ExecCodeSuccess),
+	}}
+
+	var confirmed string
+	policy := testRetryPolicy()
+	policy.Confirm = func(ctx context.Context, params Options) (bool, error) {
+		confirmed, _ = params[ParamOrderID].(string)
+		return true, nil
+	}
+	c := retryClient(transport, policy)
+
+	_, err := c.ProcessPayment(context.Background(), paymentRequest())
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if confirmed != "order_1423675675" {
+		t.Errorf("unexpected confirmed order %q", confirmed)
+	}
+	if transport.calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", transport.calls)
+	}
+}
+
+func TestRetryExecCode(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		execCodeResponse(ExecCodeBankNetworkError),
+		execCodeResponse(ExecCodeSuccess),
+	}}
+	c := retryClient(transport, testRetryPolicy())
+
+	r, err := c.ExportTransactions("2016-01-01", "2016-01-31", "test@example.org", CompressionGzip, Options{})
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if r.ExecCode() != ExecCodeSuccess {
+		t.Errorf("unexpected exec code %s", r.ExecCode())
+	}
+	if transport.calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", transport.calls)
+	}
+}
+
+func TestRetryExecCodeNeedsConfirmation(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		execCodeResponse(ExecCodeHandlerTimeout),
+		execCodeResponse(ExecCodeSuccess),
+	}}
+	c := retryClient(transport, testRetryPolicy())
+
+	// the bank may have processed the capture
+	r, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if r.ExecCode() != ExecCodeHandlerTimeout {
+		t.Errorf("unexpected exec code %s", r.ExecCode())
+	}
+	if transport.calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.calls)
+	}
+
+	transport.calls = 0
+	c.RetryPolicy.Confirm = func(ctx context.Context, params Options) (bool, error) {
+		return true, nil
+	}
+	r, err = c.Capture("A151621", "order_1423675675", "capture", Options{})
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if r.ExecCode() != ExecCodeSuccess {
+		t.Errorf("unexpected exec code %s", r.ExecCode())
+	}
+	if transport.calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", transport.calls)
+	}
+}
+
+func TestRetryStrictExecCode(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		execCodeResponse(ExecCodeBankNetworkError),
+	}}
+	c := retryClient(transport, testRetryPolicy())
+	c.StrictErrors = true
+
+	_, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+	if !errors.Is(err, ErrNetworkError) {
+		t.Errorf("expected ErrNetworkError, got %v", err)
+	}
+	if transport.calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.calls)
+	}
+
+	transport.calls = 0
+	_, err = c.ExportTransactions("2016-01-01", "2016-01-31", "test@example.org", CompressionGzip, Options{})
+	if !errors.Is(err, ErrNetworkError) {
+		t.Errorf("expected ErrNetworkError, got %v", err)
+	}
+	if transport.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", transport.calls)
+	}
+}
+
+func TestRetryConfirmError(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		serverFailure,
+		execCodeResponse(ExecCodeSuccess),
+	}}
+	confirmErr := errors.New("confirmation failed")
+	policy := testRetryPolicy()
+	policy.Confirm = func(ctx context.Context, params Options) (bool, error) {
+		return false, confirmErr
+	}
+	c := retryClient(transport, policy)
+
+	_, err := c.ProcessPayment(context.Background(), paymentRequest())
+	if e, ok := err.(*ConfirmError); !ok || e.ConfirmErr != confirmErr {
+		t.Errorf("expected a ConfirmError, got %v", err)
+	}
+	if !errors.Is(err, ErrServerError) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if transport.calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.calls)
+	}
+}
+
+func TestNoRetryFailure(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		execCodeResponse(ExecCodeCardRefused),
+	}}
+	c := retryClient(transport, testRetryPolicy())
+
+	r, err := c.Capture("A151621", "order_1423675675", "capture", Options{})
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+	if r.ExecCode() != ExecCodeCardRefused {
+		t.Errorf("unexpected exec code %s", r.ExecCode())
+	}
+	if transport.calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.calls)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		serverFailure,
+	}}
+	c := retryClient(transport, testRetryPolicy())
+
+	_, err := c.ExportTransactions("2016-01-01", "2016-01-31", "test@example.org", CompressionGzip, Options{})
+	if err != ErrServerError {
+		t.Errorf("expected ErrServerError, got %v", err)
+	}
+	if transport.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", transport.calls)
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	transport := &sequenceTransport{responses: []func(*http.Request) (*http.Response, error){
+		serverFailure,
+	}}
+	policy := testRetryPolicy()
+	policy.InitialBackoff = time.Minute
+	policy.MaxBackoff = time.Minute
+	c := retryClient(transport, policy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.ExportTransactionsContext(ctx, "2016-01-01", "2016-01-31", "test@example.org", CompressionGzip, Options{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("backoff did not stop when the context expired")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     3,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		300 * time.Millisecond,
+		900 * time.Millisecond,
+		time.Second,
+	}
+	for i, d := range expected {
+		if b := policy.backoff(i + 1); b != d {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, d, b)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if b := policy.backoff(1); b < 50*time.Millisecond || b > 100*time.Millisecond {
+			t.Fatalf("backoff out of range: %v", b)
+		}
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	testCases := []struct {
+		err       error
+		transient bool
+	}{
+		{ErrTimeout, true},
+		{ErrServerError, true},
+		{&HTTPError{StatusCode: http.StatusBadGateway}, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{ErrURLMissing, false},
+		{context.Canceled, false},
+		{&ValidationError{Field: ParamAmount, Reason: "must be positive"}, false},
+	}
+
+	for _, tc := range testCases {
+		if IsTransientError(tc.err) != tc.transient {
+			t.Errorf("%v: expected transient to be %v", tc.err, tc.transient)
+		}
+	}
+}
+
+func TestConfirmByOrderID(t *testing.T) {
+	testCases := []struct {
+		execCode ExecCode
+		none     bool
+	}{
+		{ExecCodeTransactionNotFound, true},
+		{ExecCodeSuccess, false},
+	}
+
+	for _, tc := range testCases {
+		var params Options
+		transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if err := r.ParseForm(); err != nil {
+				return nil, err
+			}
+			params = requestParameters(r.PostForm)
+			return execCodeResponse(tc.execCode)(r)
+		})
+
+		c := NewDirectLinkClient(User("foo", "bar", Environment{"https://secure.example.org"}))
+		c.HTTPClient = &http.Client{Transport: transport}
+
+		confirm := ConfirmByOrderID(c, "test@example.org")
+		none, err := confirm(context.Background(), Options{ParamOrderID: "order_1423675675"})
+		if err != nil {
+			t.Fatal("got error: ", err)
+		}
+		if none != tc.none {
+			t.Errorf("%s: expected %v, got %v", tc.execCode, tc.none, none)
+		}
+		if params[ParamOperationType] != OperationTypeGetTransactions {
+			t.Errorf("unexpected operation type %v", params[ParamOperationType])
+		}
+	}
+}
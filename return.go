@@ -0,0 +1,113 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ParseReturn verifies and returns the result of a transaction made using
+// a payment or authorization form, from the request of a customer coming
+// back to the merchant website.
+//
+// An error is returned if the request cannot be parsed, if it is not
+// signed (ErrMissingHash), or if its signature does not match the account
+// password (ErrInvalidHash), which means it has been tampered with.
+func (p *FormClient) ParseReturn(r *http.Request) (Result, error) {
+	params, err := parseSignedRequest(r, func(Options) (*Signer, error) {
+		return p.signer(), nil
+	})
+	if err != nil {
+		p.logReturn(r.Context(), nil, err)
+		return nil, err
+	}
+	p.logReturn(r.Context(), Result(params), nil)
+	return Result(params), nil
+}
+
+// A ReturnFunc renders the page displayed to a customer coming back to
+// the merchant website after a form payment or authorization.
+type ReturnFunc func(w http.ResponseWriter, r *http.Request, result Result)
+
+// A ReturnHandler is an http.Handler for the page customers are redirected
+// to after filling a payment or authorization form.
+//
+// Once the request has been verified, the Success function is called if
+// the transaction succeeded, and the Failure function otherwise, so that
+// different templates can be rendered.
+// A nil Success or Failure function is replaced by a plain text page
+// showing the message of the result.
+type ReturnHandler struct {
+	credentials *Credentials
+	hasher      Hasher
+	registry    *Registry
+	// Success renders the page of successful transactions.
+	Success ReturnFunc
+	// Failure renders the page of failed transactions.
+	Failure ReturnFunc
+	// Error, if not nil, is called when the request cannot be parsed or
+	// when its signature is missing or invalid.
+	// Otherwise, a 400 Bad Request or a 403 Forbidden response is sent.
+	Error func(w http.ResponseWriter, r *http.Request, err error)
+	// Signer, if not nil, verifies the requests instead of the password
+	// of the credentials, for example during a password rotation.
+	Signer *Signer
+}
+
+// NewReturnHandler returns a new ReturnHandler using the given credentials
+// to verify requests.
+func NewReturnHandler(credentials *Credentials, success, failure ReturnFunc) *ReturnHandler {
+	return &ReturnHandler{
+		credentials: credentials,
+		hasher:      &defaultHasher{},
+		Success:     success,
+		Failure:     failure,
+	}
+}
+
+func (p *ReturnHandler) signerFor(params Options) (*Signer, error) {
+	switch {
+	case p.Signer != nil:
+		return p.Signer, nil
+	case p.registry != nil:
+		return p.registry.signerFor(params)
+	}
+	return newPasswordSigner(p.hasher, p.credentials.password), nil
+}
+
+func (p *ReturnHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSignedRequest(r, p.signerFor)
+	if err != nil {
+		if p.Error != nil {
+			p.Error(w, r, err)
+			return
+		}
+
+		status := http.StatusForbidden
+		if _, ok := err.(*RequestError); ok {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	result := Result(params)
+	render := p.Failure
+	if result.Success() {
+		render = p.Success
+	}
+	if render == nil {
+		render = renderReturnMessage
+	}
+	render(w, r, result)
+}
+
+// renderReturnMessage is the ReturnFunc of the handlers without Success
+// or Failure function.
+func renderReturnMessage(w http.ResponseWriter, r *http.Request, result Result) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, result.Message())
+}
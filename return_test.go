@@ -0,0 +1,94 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormClientParseReturn(t *testing.T) {
+	client := BuildSandboxFormClient("foo", "bar")
+
+	req := httptest.NewRequest("GET", "/return?"+signedParams("bar", ExecCodeSuccess).urlValues().Encode(), nil)
+	result, err := client.ParseReturn(req)
+	if err != nil {
+		t.Fatal("got error: ", err)
+	}
+
+	if !result.Success() {
+		t.Errorf("exec code %s, message: %s", result.ExecCode(), result.Message())
+	}
+	if result.TransactionID() != "A151621" {
+		t.Errorf("unexpected transaction ID: %s", result.TransactionID())
+	}
+	if result.OrderID() != "order_1423675675" {
+		t.Errorf("unexpected order ID: %s", result.OrderID())
+	}
+	if result.Alias() != "A151621" {
+		t.Errorf("unexpected alias: %s", result.Alias())
+	}
+
+	tampered := signedParams("bar", ExecCodeCardRefused)
+	tampered[ResultParamExecCode] = ExecCodeSuccess
+	req = httptest.NewRequest("GET", "/return?"+tampered.urlValues().Encode(), nil)
+	if _, err := client.ParseReturn(req); err != ErrInvalidHash {
+		t.Errorf("got error: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/return?ORDERID=order_1423675675&EXECCODE=0000", nil)
+	if _, err := client.ParseReturn(req); err != ErrMissingHash {
+		t.Errorf("got error: %v", err)
+	}
+}
+
+func TestReturnHandler(t *testing.T) {
+	render := func(page string) ReturnFunc {
+		return func(w http.ResponseWriter, r *http.Request, result Result) {
+			fmt.Fprintf(w, "%s %s", page, result.OrderID())
+		}
+	}
+	h := NewReturnHandler(SandboxUser("foo", "bar"), render("success"), render("failure"))
+
+	testCases := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{signedParams("bar", ExecCodeSuccess).urlValues().Encode(), http.StatusOK, "success order_1423675675"},
+		{signedParams("bar", ExecCodeCardRefused).urlValues().Encode(), http.StatusOK, "failure order_1423675675"},
+		{signedParams("baz", ExecCodeSuccess).urlValues().Encode(), http.StatusForbidden, "Forbidden\n"},
+		{"ORDERID=order_1423675675&EXECCODE=0000", http.StatusForbidden, "Forbidden\n"},
+		{"HASH=%zz", http.StatusBadRequest, "Bad Request\n"},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/return", nil)
+		req.URL.RawQuery = tc.query
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: unexpected status: %d", tc.query, w.Code)
+		}
+		if w.Body.String() != tc.body {
+			t.Errorf("%s: unexpected body: %q", tc.query, w.Body.String())
+		}
+	}
+}
+
+func TestReturnHandlerDefaultPages(t *testing.T) {
+	h := NewReturnHandler(SandboxUser("foo", "bar"), nil, nil)
+
+	for _, execCode := range []ExecCode{ExecCodeSuccess, ExecCodeCardRefused} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/return?"+signedParams("bar", execCode).urlValues().Encode(), nil))
+		if w.Code != http.StatusOK || w.Body.String() != "The transaction has been accepted.\n" {
+			t.Errorf("%s: unexpected response %d: %q", execCode, w.Code, w.Body.String())
+		}
+	}
+}
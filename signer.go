@@ -0,0 +1,111 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"crypto/subtle"
+	"time"
+)
+
+// A Secret is a password of a be2bill account used to sign requests.
+type Secret struct {
+	// ID identifies the secret, and is returned by Signer.Verify when
+	// a request is signed with it.
+	ID string
+	// Password is the password of the account.
+	Password string
+	// NotAfter is the time after which requests signed with the secret
+	// are no longer accepted. A zero value means the secret never expires.
+	NotAfter time.Time
+}
+
+// active returns true if the secret can be used to verify requests
+// at the given time.
+func (p *Secret) active(now time.Time) bool {
+	return p.NotAfter.IsZero() || !now.After(p.NotAfter)
+}
+
+// A Signer signs the requests sent to the be2bill servers, and verifies
+// the requests received from them or from customers.
+//
+// A Signer supports the rotation of the account password: requests are
+// always signed with the primary secret, while received requests are
+// verified against every active secret. When the password is changed in
+// the be2bill back-office, the new one becomes the primary secret and
+// the previous one is kept with a NotAfter date, until the notifications
+// signed with it have been delivered.
+//
+// A Signer is safe for concurrent use.
+type Signer struct {
+	hasher  Hasher
+	primary Secret
+	secrets []Secret
+	now     func() time.Time
+}
+
+// NewSigner returns a new Signer using the given hasher, signing requests
+// with the primary secret, and also accepting the requests signed with
+// the other secrets until they expire.
+// The NotAfter date of the primary secret is ignored.
+// If hasher is nil, the default hasher is used.
+func NewSigner(hasher Hasher, primary Secret, secrets ...Secret) *Signer {
+	if hasher == nil {
+		hasher = &defaultHasher{}
+	}
+	return &Signer{
+		hasher:  hasher,
+		primary: primary,
+		secrets: append([]Secret(nil), secrets...),
+		now:     time.Now,
+	}
+}
+
+// newPasswordSigner returns the Signer used when no other is configured,
+// which signs and verifies requests with the given password only.
+func newPasswordSigner(hasher Hasher, password string) *Signer {
+	return NewSigner(hasher, Secret{Password: password})
+}
+
+// Sign returns the hash of the given parameters computed with
+// the primary secret.
+func (p *Signer) Sign(params Options) string {
+	return p.hasher.ComputeHash(p.primary.Password, params)
+}
+
+// Verify checks the HASH parameter of the given parameters against
+// the primary secret, then against the other active secrets, and
+// returns the identifier of the secret that matches.
+//
+// It returns ErrMissingHash if the parameters are not signed, and
+// ErrInvalidHash if no active secret matches their hash.
+func (p *Signer) Verify(params Options) (string, error) {
+	receivedHash, ok := params[ParamHash].(string)
+	if !ok {
+		return "", ErrMissingHash
+	}
+
+	if equalHashes(receivedHash, p.hasher.ComputeHash(p.primary.Password, params)) {
+		return p.primary.ID, nil
+	}
+
+	now := p.now()
+	for i := range p.secrets {
+		secret := &p.secrets[i]
+		if !secret.active(now) {
+			continue
+		}
+		if equalHashes(receivedHash, p.hasher.ComputeHash(secret.Password, params)) {
+			return secret.ID, nil
+		}
+	}
+
+	return "", ErrInvalidHash
+}
+
+// equalHashes compares two hashes in constant time, so the comparison
+// does not reveal how much of a forged hash is correct.
+func equalHashes(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
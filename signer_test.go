@@ -0,0 +1,95 @@
+// Copyright 2016 Marc Noirot. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package be2bill
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2016, 5, 14, 12, 0, 0, 0, time.UTC)
+	s := NewSigner(nil,
+		Secret{ID: "2016-05", Password: "new"},
+		Secret{ID: "2016-04", Password: "old", NotAfter: now.Add(time.Hour)},
+		Secret{ID: "2016-03", Password: "expired", NotAfter: now.Add(-time.Hour)},
+	)
+	s.now = func() time.Time { return now }
+
+	params := signedParams("new", ExecCodeSuccess)
+	if h := s.Sign(params); h != params[ParamHash] {
+		t.Errorf("not signed with the primary secret: %s", h)
+	}
+
+	testCases := []struct {
+		params Options
+		id     string
+		err    error
+	}{
+		{signedParams("new", ExecCodeSuccess), "2016-05", nil},
+		{signedParams("old", ExecCodeSuccess), "2016-04", nil},
+		{signedParams("expired", ExecCodeSuccess), "", ErrInvalidHash},
+		{signedParams("unknown", ExecCodeSuccess), "", ErrInvalidHash},
+		{Options{ParamOrderID: "order_1"}, "", ErrMissingHash},
+	}
+	for _, tc := range testCases {
+		id, err := s.Verify(tc.params)
+		if id != tc.id || err != tc.err {
+			t.Errorf("expected %q, %v, got %q, %v", tc.id, tc.err, id, err)
+		}
+	}
+
+	// once the old secret expires
+	now = now.Add(2 * time.Hour)
+	if _, err := s.Verify(signedParams("old", ExecCodeSuccess)); err != ErrInvalidHash {
+		t.Errorf("expired secret accepted: %v", err)
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	opts := Options{"c": 3, "a": "1", "b": "2"}
+
+	if h := NewHasher(SHA256).ComputeHash("password", opts); h != "77c71c1e70ea28525cf078537d22d1932922e3741ed83287b0dc0a117bf77999" {
+		t.Error("Got", h)
+	}
+
+	hmacHasher := NewHasher(func(password string) hash.Hash {
+		return hmac.New(sha256.New, []byte(password))
+	})
+	h := hmacHasher.ComputeHash("password", opts)
+	if len(h) != 64 || h == DefaultHasher().ComputeHash("password", opts) {
+		t.Errorf("unexpected HMAC hash: %s", h)
+	}
+	if h == hmacHasher.ComputeHash("other", opts) {
+		t.Error("the password is not used as key")
+	}
+
+	s := NewSigner(hmacHasher, Secret{Password: "password"})
+	opts[ParamHash] = s.Sign(opts)
+	if _, err := s.Verify(opts); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNotificationHandlerSigner(t *testing.T) {
+	h := NewNotificationHandler(SandboxUser("foo", "new"), func(r *http.Request, result Result) error {
+		return nil
+	})
+	h.Signer = NewSigner(nil, Secret{ID: "new", Password: "new"}, Secret{ID: "old", Password: "old"})
+
+	for _, password := range []string{"new", "old"} {
+		w := postNotification(h, signedParams(password, ExecCodeSuccess).urlValues().Encode())
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status: %d", password, w.Code)
+		}
+	}
+	if w := postNotification(h, signedParams("other", ExecCodeSuccess).urlValues().Encode()); w.Code != http.StatusForbidden {
+		t.Errorf("unexpected status: %d", w.Code)
+	}
+}